@@ -0,0 +1,238 @@
+package core
+
+import (
+	"backend/api/claims_extraction_helper"
+	"backend/global"
+	"backend/internal/middlewares"
+	"backend/payloads/request"
+	"backend/service/core_service"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// GetRowComments handles GET /files/{fileId}/rows/{rowId}/comments
+func GetRowComments(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["fileId"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	rowID, err := strconv.Atoi(values["rowId"])
+	if err != nil {
+		http.Error(w, "Invalid row ID", http.StatusBadRequest)
+		return
+	}
+
+	threads, err := core_service.GetRowCommentsService(userID, fileID, rowID)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Success", threads, w)
+}
+
+// CreateComment handles POST /files/{fileId}/rows/{rowId}/comments
+func CreateComment(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["fileId"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	rowID, err := strconv.Atoi(values["rowId"])
+	if err != nil {
+		http.Error(w, "Invalid row ID", http.StatusBadRequest)
+		return
+	}
+
+	var commentReq request.CommentRequest
+	if err := json.NewDecoder(req.Body).Decode(&commentReq); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	comment, err := core_service.CreateCommentService(userID, fileID, rowID, commentReq)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Comment added", comment, w)
+}
+
+// GetFileThreads handles GET /files/{id}/comments. Only open threads are
+// listed unless ?resolved=true.
+func GetFileThreads(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	includeResolved := false
+	if value := req.URL.Query().Get("resolved"); value != "" {
+		includeResolved, err = strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "resolved must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	threads, err := core_service.GetFileThreadsService(userID, fileID, includeResolved)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Success", threads, w)
+}
+
+// UpdateComment handles PUT /files/{id}/comments/{commentId}
+func UpdateComment(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	userID, fileID, commentID, ok := commentRequestIDs(w, req)
+	if !ok {
+		return
+	}
+
+	var commentReq request.CommentRequest
+	if err := json.NewDecoder(req.Body).Decode(&commentReq); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	comment, err := core_service.UpdateCommentService(userID, fileID, commentID, commentReq.Body)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Comment updated", comment, w)
+}
+
+// DeleteComment handles DELETE /files/{id}/comments/{commentId}
+func DeleteComment(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	userID, fileID, commentID, ok := commentRequestIDs(w, req)
+	if !ok {
+		return
+	}
+
+	if err := core_service.DeleteCommentService(userID, fileID, commentID); err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.Success("Comment deleted", w)
+}
+
+// ResolveThread handles PUT /files/{id}/comments/{commentId}/resolved
+func ResolveThread(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	userID, fileID, commentID, ok := commentRequestIDs(w, req)
+	if !ok {
+		return
+	}
+
+	var resolveReq request.ResolveThreadRequest
+	if err := json.NewDecoder(req.Body).Decode(&resolveReq); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	thread, err := core_service.ResolveThreadService(userID, fileID, commentID, resolveReq.Resolved)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	message := "Thread reopened"
+	if resolveReq.Resolved {
+		message = "Thread resolved"
+	}
+	global.SuccessWithBody(message, thread, w)
+}
+
+func commentRequestIDs(w http.ResponseWriter, req *http.Request) (userID, fileID int, commentID int64, ok bool) {
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, 0, 0, false
+	}
+
+	fileID, err = strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return 0, 0, 0, false
+	}
+
+	commentID, err = strconv.ParseInt(values["commentId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return 0, 0, 0, false
+	}
+
+	return userID, fileID, commentID, true
+}
@@ -4,11 +4,15 @@ import (
 	"backend/api/claims_extraction_helper"
 	"backend/global"
 	"backend/internal/middlewares"
+	"backend/payloads/request"
+	"backend/payloads/response"
 	"backend/service/core_service"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -67,7 +71,20 @@ func GetUploadedFiles( w http.ResponseWriter, req *http.Request){
 	response,err := core_service.GetUploadedFilesService(id)
 
 	if err!=nil {
-		http.Error(w,err.Error(),http.StatusBadRequest)
+		global.HandleError(err,w)
+		return
+	}
+
+	// The list has no counter of its own, so its ETag hashes what it lists.
+	var modified time.Time
+	var fingerprint strings.Builder
+	for _, file := range response {
+		fmt.Fprintf(&fingerprint, "%d:%d:%s\n", file.ID, file.ChangeCount, file.Filename)
+		if file.ModifiedAt.After(modified) {
+			modified = file.ModifiedAt
+		}
+	}
+	if notModified(w, req, `"`+hashETag(fingerprint.String())+`"`, modified) {
 		return
 	}
 
@@ -98,10 +115,27 @@ func GetRows( w http.ResponseWriter, req *http.Request){
 		return
 	}
 
-	response,err := core_service.GetRows(id,fileID)
+	query, err := parseRowsQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Read the counter before the rows so the ETag is never newer than
+	// the body it goes out with.
+	changeCount, modified, err := core_service.FileVersionService(id, fileID)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+	if notModified(w, req, fileETag(fileID, changeCount, req.URL.Query().Encode()), modified) {
+		return
+	}
+
+	response,err := core_service.GetRows(id,fileID,query)
 
 	if err!=nil {
-		http.Error(w,err.Error(),http.StatusBadRequest)
+		global.HandleError(err,w)
 		return
 	}
 
@@ -131,10 +165,7 @@ func CreateRow(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// Parse request body
-	var reqBody struct {
-		Position  float64 `json:"position"`
-		InputText string  `json:"input_text"`
-	}
+	var reqBody request.RowRequest
 
 	if err := json.NewDecoder(req.Body).Decode(&reqBody); err != nil {
 		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
@@ -147,12 +178,14 @@ func CreateRow(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	response, err := core_service.CreateRowService(userID, fileID, reqBody.Position, reqBody.InputText)
+	response, err := core_service.CreateRowService(userID, fileID, reqBody)
 	if err != nil {
 		global.HandleError(err, w)
 		return
 	}
 
+	w.Header().Set("ETag", rowETag(response.Version))
+
 	global.SuccessWithBody("Row created successfully", response, w)
 }
 
@@ -185,10 +218,7 @@ func UpdateRow(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// Parse request body
-	var reqBody struct {
-		Position  float64 `json:"position"`
-		InputText string  `json:"input_text"`
-	}
+	var reqBody request.RowRequest
 
 	if err := json.NewDecoder(req.Body).Decode(&reqBody); err != nil {
 		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
@@ -201,12 +231,20 @@ func UpdateRow(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	response, err := core_service.UpdateRowService(userID, fileID, rowID, reqBody.Position, reqBody.InputText)
+	reqBody.Version, err = ifMatchVersion(req)
 	if err != nil {
 		global.HandleError(err, w)
 		return
 	}
 
+	response, err := core_service.UpdateRowService(userID, fileID, rowID, reqBody)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	w.Header().Set("ETag", rowETag(response.Version))
+
 	global.SuccessWithBody("Row updated successfully", response, w)
 }
 
@@ -243,7 +281,13 @@ func DeleteRow(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	err = core_service.DeleteRowService(userID, fileID, rowID)
+	version, err := ifMatchVersion(req)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	err = core_service.DeleteRowService(userID, fileID, rowID, version)
 	if err != nil {
 		fmt.Print("3")
 		global.HandleError(err, w)
@@ -251,4 +295,436 @@ func DeleteRow(w http.ResponseWriter, req *http.Request) {
 	}
 
 	global.Success("Row deleted successfully", w)
-}
\ No newline at end of file
+}
+
+// RebalanceFile handles POST /files/{id}/rebalance
+func RebalanceFile(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	renumbered, err := core_service.RebalanceFileService(userID, fileID)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("File rebalanced successfully", response.RebalanceResponse{
+		RowsRenumbered: renumbered,
+	}, w)
+}
+
+// ReorderRows handles POST /files/{id}/rows/reorder
+func ReorderRows(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	var reqBody request.ReorderRowsRequest
+	if err := json.NewDecoder(req.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := core_service.ReorderRowsService(userID, fileID, reqBody)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Rows reordered successfully", response, w)
+}
+
+// BatchRows handles POST /files/{id}/rows/batch
+func BatchRows(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	var reqBody request.BatchRowsRequest
+	if err := json.NewDecoder(req.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := core_service.BatchRowsService(userID, fileID, reqBody)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Batch applied successfully", response, w)
+}
+
+// BulkInsertRows handles POST /files/{id}/rows/bulk
+func BulkInsertRows(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	var reqBody request.BulkInsertRowsRequest
+	if err := json.NewDecoder(req.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := core_service.BulkInsertRowsService(userID, fileID, reqBody)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Rows inserted successfully", response, w)
+}
+
+// DeleteRows handles DELETE /files/{id}/rows
+func DeleteRows(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	var reqBody request.DeleteRowsRequest
+	if err := json.NewDecoder(req.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := core_service.DeleteRowsService(userID, fileID, reqBody)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	if response.DryRun {
+		global.SuccessWithBody("Dry run, nothing deleted", response, w)
+		return
+	}
+	global.SuccessWithBody("Rows deleted successfully", response, w)
+}
+
+// ReplaceRows handles POST /files/{id}/replace
+func ReplaceRows(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	var reqBody request.ReplaceRequest
+	if err := json.NewDecoder(req.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := core_service.ReplaceService(userID, fileID, reqBody)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	if response.Preview {
+		global.SuccessWithBody("Preview, nothing replaced", response, w)
+		return
+	}
+	global.SuccessWithBody("Rows updated successfully", response, w)
+}
+
+// DedupeRows handles POST /files/{id}/dedupe
+func DedupeRows(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	var reqBody request.DedupeRequest
+	if err := json.NewDecoder(req.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := core_service.DedupeService(userID, fileID, reqBody)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	if reqBody.Delete {
+		global.SuccessWithBody("Duplicate rows deleted", response, w)
+		return
+	}
+	global.SuccessWithBody("Success", response, w)
+}
+
+// GetRowsPage handles GET /files/{id}/rows?filter=&sort=&limit=&cursor=&count=&q=&mode=&threshold=
+func GetRowsPage(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	query, err := parseRowsQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := core_service.GetRowsPageService(userID, fileID, query)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Success", response, w)
+}
+
+// parseRowsQuery reads the rows listing filters and paging parameters from
+// the query string.
+func parseRowsQuery(req *http.Request) (request.RowsQuery, error) {
+	params := req.URL.Query()
+	query := request.RowsQuery{
+		Filter: params.Get("filter"),
+		Sort:   params.Get("sort"),
+		Cursor: params.Get("cursor"),
+		Search: params.Get("q"),
+		Mode:   params.Get("mode"),
+	}
+
+	for _, value := range params["label"] {
+		labelID, err := strconv.Atoi(value)
+		if err != nil {
+			return query, fmt.Errorf("invalid label ID")
+		}
+		query.LabelIDs = append(query.LabelIDs, labelID)
+	}
+
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return query, fmt.Errorf("limit must be a number")
+		}
+		query.Limit = limit
+	}
+
+	if value := params.Get("threshold"); value != "" {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return query, fmt.Errorf("threshold must be a number")
+		}
+		query.Threshold = &threshold
+	}
+
+	if value := params.Get("count"); value != "" {
+		count, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, fmt.Errorf("count must be true or false")
+		}
+		query.Count = count
+	}
+
+	if value := params.Get("ordinals"); value != "" {
+		ordinals, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, fmt.Errorf("ordinals must be true or false")
+		}
+		query.Ordinals = ordinals
+	}
+
+	return query, nil
+}
+
+// GetRowRange handles GET /files/{id}/range?from=&to=
+func GetRowRange(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	from, err := strconv.Atoi(req.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "from must be a number", http.StatusBadRequest)
+		return
+	}
+	to, err := strconv.Atoi(req.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "to must be a number", http.StatusBadRequest)
+		return
+	}
+
+	response, err := core_service.GetRowRangeService(userID, fileID, from, to)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Success", response, w)
+}
+
+// GetFileStats handles GET /files/{id}/stats
+func GetFileStats(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	response, err := core_service.GetFileStatsService(userID, fileID)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Success", response, w)
+}
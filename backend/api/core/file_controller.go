@@ -0,0 +1,51 @@
+package core
+
+import (
+	"backend/api/claims_extraction_helper"
+	"backend/global"
+	"backend/internal/middlewares"
+	"backend/payloads/request"
+	"backend/service/core_service"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// UpdateFile handles PATCH /files/{id}
+func UpdateFile(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPatch {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	var fileReq request.FileRequest
+	if err := json.NewDecoder(req.Body).Decode(&fileReq); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := core_service.UpdateFileService(userID, fileID, fileReq)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("File updated successfully", response, w)
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"backend/api/claims_extraction_helper"
+	"backend/global"
+	"backend/internal/middlewares"
+	"backend/payloads/request"
+	"backend/payloads/response"
+	"backend/service/core_service"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// GetLabels handles GET /files/{id}/labels
+func GetLabels(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	labels, err := core_service.ListLabelsService(userID, fileID)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Success", labels, w)
+}
+
+// CreateLabel handles POST /files/{id}/labels
+func CreateLabel(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	var labelReq request.LabelRequest
+	if err := json.NewDecoder(req.Body).Decode(&labelReq); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	label, err := core_service.CreateLabelService(userID, fileID, labelReq)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Label created successfully", label, w)
+}
+
+// UpdateLabel handles PUT /files/{id}/labels/{labelId}
+func UpdateLabel(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	userID, fileID, labelID, ok := labelRequestIDs(w, req)
+	if !ok {
+		return
+	}
+
+	var labelReq request.LabelRequest
+	if err := json.NewDecoder(req.Body).Decode(&labelReq); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	label, err := core_service.UpdateLabelService(userID, fileID, labelID, labelReq)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Label updated successfully", label, w)
+}
+
+// DeleteLabel handles DELETE /files/{id}/labels/{labelId}
+func DeleteLabel(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	userID, fileID, labelID, ok := labelRequestIDs(w, req)
+	if !ok {
+		return
+	}
+
+	if err := core_service.DeleteLabelService(userID, fileID, labelID); err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.Success("Label deleted successfully", w)
+}
+
+// AttachLabel handles POST /files/{id}/labels/{labelId}/rows
+func AttachLabel(w http.ResponseWriter, req *http.Request) {
+	labelRows(w, req, http.MethodPost, core_service.AttachLabelService, "Label attached")
+}
+
+// DetachLabel handles DELETE /files/{id}/labels/{labelId}/rows
+func DetachLabel(w http.ResponseWriter, req *http.Request) {
+	labelRows(w, req, http.MethodDelete, core_service.DetachLabelService, "Label detached")
+}
+
+func labelRows(w http.ResponseWriter, req *http.Request, method string, service func(userID, fileID, labelID int, rowIDs []int) (int64, error), message string) {
+	if req.Method != method {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	userID, fileID, labelID, ok := labelRequestIDs(w, req)
+	if !ok {
+		return
+	}
+
+	var rowsReq request.LabelRowsRequest
+	if err := json.NewDecoder(req.Body).Decode(&rowsReq); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(rowsReq.RowIDs) == 0 {
+		http.Error(w, "row_ids cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	changed, err := service(userID, fileID, labelID, rowsReq.RowIDs)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody(message, response.LabelRowsResponse{RowsChanged: changed}, w)
+}
+
+func labelRequestIDs(w http.ResponseWriter, req *http.Request) (userID, fileID, labelID int, ok bool) {
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, 0, 0, false
+	}
+
+	fileID, err = strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return 0, 0, 0, false
+	}
+
+	labelID, err = strconv.Atoi(values["labelId"])
+	if err != nil {
+		http.Error(w, "Invalid label ID", http.StatusBadRequest)
+		return 0, 0, 0, false
+	}
+
+	return userID, fileID, labelID, true
+}
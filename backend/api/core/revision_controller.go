@@ -0,0 +1,92 @@
+package core
+
+import (
+	"backend/api/claims_extraction_helper"
+	"backend/global"
+	"backend/internal/middlewares"
+	"backend/service/core_service"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// GetRowHistory handles GET /files/{fileId}/rows/{rowId}/history
+func GetRowHistory(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["fileId"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	rowID, err := strconv.Atoi(values["rowId"])
+	if err != nil {
+		http.Error(w, "Invalid row ID", http.StatusBadRequest)
+		return
+	}
+
+	response, err := core_service.GetRowHistoryService(userID, fileID, rowID)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Success", response, w)
+}
+
+// RestoreRowRevision handles POST /files/{fileId}/rows/{rowId}/history/{revisionId}/restore
+func RestoreRowRevision(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["fileId"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	rowID, err := strconv.Atoi(values["rowId"])
+	if err != nil {
+		http.Error(w, "Invalid row ID", http.StatusBadRequest)
+		return
+	}
+
+	revisionID, err := strconv.Atoi(values["revisionId"])
+	if err != nil {
+		http.Error(w, "Invalid revision ID", http.StatusBadRequest)
+		return
+	}
+
+	response, err := core_service.RestoreRevisionService(userID, fileID, rowID, revisionID)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Revision restored successfully", response, w)
+}
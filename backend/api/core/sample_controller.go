@@ -0,0 +1,102 @@
+package core
+
+import (
+	"backend/api/claims_extraction_helper"
+	"backend/global"
+	"backend/internal/middlewares"
+	"backend/payloads/request"
+	"backend/service/core_service"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// GetSample handles GET /files/{id}/sample?size=&seed=&stratify=&filter=&label=
+func GetSample(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	query, err := parseRowsQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := req.URL.Query()
+	sample := request.SampleRequest{
+		Seed:     params.Get("seed"),
+		Stratify: params.Get("stratify"),
+		LabelIDs: query.LabelIDs,
+		Filter:   query.Filter,
+	}
+	sample.Size, err = strconv.Atoi(params.Get("size"))
+	if err != nil {
+		http.Error(w, "size must be a number", http.StatusBadRequest)
+		return
+	}
+
+	response, err := core_service.SampleService(userID, fileID, sample)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Success", response, w)
+}
+
+// SaveSample handles POST /files/{id}/sample, which saves the sample as a
+// new file.
+func SaveSample(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	var sample request.SampleRequest
+	if err := json.NewDecoder(req.Body).Decode(&sample); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	response, err := core_service.SaveSampleService(userID, fileID, sample)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Sample saved as a new file", response, w)
+}
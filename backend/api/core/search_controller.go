@@ -0,0 +1,50 @@
+package core
+
+import (
+	"backend/api/claims_extraction_helper"
+	"backend/global"
+	"backend/internal/middlewares"
+	"backend/payloads/request"
+	"backend/service/core_service"
+	"net/http"
+	"strconv"
+)
+
+// Search handles GET /search?q=&file_id=&limit=&offset=
+func Search(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := req.URL.Query()
+	search := request.SearchQuery{Query: params.Get("q")}
+
+	for name, dest := range map[string]*int{"file_id": &search.FileID, "limit": &search.Limit, "offset": &search.Offset} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		*dest, err = strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, name+" must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	results, err := core_service.SearchService(userID, search)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody("Success", results, w)
+}
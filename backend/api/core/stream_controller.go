@@ -0,0 +1,107 @@
+package core
+
+import (
+	"backend/api/claims_extraction_helper"
+	"backend/global"
+	"backend/internal/middlewares"
+	"backend/payloads/response"
+	"backend/service/core_service"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// streamFlushEvery is how many rows are written between flushes.
+const streamFlushEvery = 500
+
+// streamError is the last line of a stream that failed after its first row.
+type streamError struct {
+	Error string `json:"error"`
+}
+
+// StreamRows handles GET /files/{id}/stream. It writes the file's rows as
+// NDJSON, one row object per line, while they are read from the database.
+// It takes the same filter, sort and label parameters as GET /files/{id}.
+//
+// Errors before the first row get the usual error status. Once rows have
+// gone out the status is already 200, so a failure ends the stream with a
+// last line of the form {"error": "..."}. Row objects never carry an error
+// key, so a client should treat a stream ending in one as incomplete.
+func StreamRows(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	query, err := parseRowsQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	written := 0
+
+	err = core_service.StreamRowsService(req.Context(), userID, fileID, query, func(row *response.GetRowsResponse) error {
+		if written == 0 {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+		}
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+
+		written++
+		if flusher != nil && written%streamFlushEvery == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+
+	// Once rows have gone out the status can no longer change, so a failure
+	// is reported in a last line instead.
+	if err != nil && written > 0 {
+		fmt.Printf("Stream of file %d stopped after %d rows: %v\n", fileID, written, err)
+		if req.Context().Err() == nil {
+			encoder.Encode(streamError{Error: err.Error()})
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return
+	}
+	if err != nil {
+		if req.Context().Err() != nil {
+			return
+		}
+		global.HandleError(err, w)
+		return
+	}
+
+	if written == 0 {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"backend/api/claims_extraction_helper"
+	"backend/global"
+	"backend/internal/middlewares"
+	"backend/payloads/response"
+	"backend/service/core_service"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Undo handles POST /files/{id}/undo
+func Undo(w http.ResponseWriter, req *http.Request) {
+	replay(w, req, core_service.UndoService, "Operation undone")
+}
+
+// Redo handles POST /files/{id}/redo
+func Redo(w http.ResponseWriter, req *http.Request) {
+	replay(w, req, core_service.RedoService, "Operation redone")
+}
+
+func replay(w http.ResponseWriter, req *http.Request, service func(userID, fileID int) (*response.UndoResponse, error), message string) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusBadRequest)
+		return
+	}
+
+	values := mux.Vars(req)
+	claimsValue := req.Context().Value(middlewares.ClaimsKey)
+
+	userID, err := claims_extraction_helper.ParseClaims(claimsValue)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(values["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := service(userID, fileID)
+	if err != nil {
+		global.HandleError(err, w)
+		return
+	}
+
+	global.SuccessWithBody(message, result, w)
+}
@@ -5,9 +5,12 @@ import (
 	"backend/api/core"
 	"backend/internal/db"
 	"backend/internal/middlewares"
+	"backend/service/core_service"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 )
@@ -30,6 +33,17 @@ func main() {
 		return
 	}
 
+	// Purge expired trash in the background
+	retentionDays := 30
+	if value, exists := os.LookupEnv("TRASH_RETENTION_DAYS"); exists {
+		retentionDays, err = strconv.Atoi(value)
+		if err != nil || retentionDays < 0 {
+			fmt.Println("TRASH_RETENTION_DAYS must be a non-negative number of days.")
+			return
+		}
+	}
+	core_service.StartTrashPurger(time.Duration(retentionDays)*24*time.Hour, time.Hour)
+
 	port, exists := os.LookupEnv("PORT")
 	if !exists {
 		fmt.Println("PORT not specified in environment.")
@@ -70,13 +84,73 @@ func LoadApis(router *mux.Router) {
 	)
 	router.Handle("/files/{id}",
 		middlewares.JwtFilter(http.HandlerFunc(core.GetRows)),
-	)
+	).Methods("GET")
+	router.Handle("/files/{id}",
+		middlewares.JwtFilter(http.HandlerFunc(core.TrashFile)),
+	).Methods("DELETE")
+	router.Handle("/files/{id}",
+		middlewares.JwtFilter(http.HandlerFunc(core.UpdateFile)),
+	).Methods("PATCH")
+
+	router.Handle("/files/{id}/stream",
+		middlewares.JwtFilter(http.HandlerFunc(core.StreamRows)),
+	).Methods("GET")
+
+	router.Handle("/files/{id}/sample",
+		middlewares.JwtFilter(http.HandlerFunc(core.GetSample)),
+	).Methods("GET")
+	router.Handle("/files/{id}/sample",
+		middlewares.JwtFilter(http.HandlerFunc(core.SaveSample)),
+	).Methods("POST")
+
+	router.Handle("/files/{id}/split",
+		middlewares.JwtFilter(http.HandlerFunc(core.SplitFile)),
+	).Methods("POST")
+	router.Handle("/files/{id}/splits",
+		middlewares.JwtFilter(http.HandlerFunc(core.GetSplits)),
+	).Methods("GET")
+
+	router.Handle("/files/{id}/stats",
+		middlewares.JwtFilter(http.HandlerFunc(core.GetFileStats)),
+	).Methods("GET")
 
 	// Row operations
+	router.Handle("/files/{id}/rows",
+		middlewares.JwtFilter(http.HandlerFunc(core.GetRowsPage)),
+	).Methods("GET")
+
+	router.Handle("/files/{id}/range",
+		middlewares.JwtFilter(http.HandlerFunc(core.GetRowRange)),
+	).Methods("GET")
+
 	router.Handle("/files/{id}/rows",
 		middlewares.JwtFilter(http.HandlerFunc(core.CreateRow)),
 	).Methods("POST")
 
+	router.Handle("/files/{id}/rows",
+		middlewares.JwtFilter(http.HandlerFunc(core.DeleteRows)),
+	).Methods("DELETE")
+
+	router.Handle("/files/{id}/rows/bulk",
+		middlewares.JwtFilter(http.HandlerFunc(core.BulkInsertRows)),
+	).Methods("POST")
+
+	router.Handle("/files/{id}/rows/batch",
+		middlewares.JwtFilter(http.HandlerFunc(core.BatchRows)),
+	).Methods("POST")
+
+	router.Handle("/files/{id}/rows/reorder",
+		middlewares.JwtFilter(http.HandlerFunc(core.ReorderRows)),
+	).Methods("POST")
+
+	router.Handle("/files/{id}/dedupe",
+		middlewares.JwtFilter(http.HandlerFunc(core.DedupeRows)),
+	).Methods("POST")
+
+	router.Handle("/files/{id}/replace",
+		middlewares.JwtFilter(http.HandlerFunc(core.ReplaceRows)),
+	).Methods("POST")
+
 	router.Handle("/files/{fileId}/rows/{rowId}",
 		middlewares.JwtFilter(http.HandlerFunc(core.UpdateRow)),
 	).Methods("PUT")
@@ -85,6 +159,84 @@ func LoadApis(router *mux.Router) {
 		middlewares.JwtFilter(http.HandlerFunc(core.DeleteRow)),
 	).Methods("DELETE")
 
+	// Row history
+	router.Handle("/files/{fileId}/rows/{rowId}/history",
+		middlewares.JwtFilter(http.HandlerFunc(core.GetRowHistory)),
+	).Methods("GET")
+
+	router.Handle("/files/{fileId}/rows/{rowId}/history/{revisionId}/restore",
+		middlewares.JwtFilter(http.HandlerFunc(core.RestoreRowRevision)),
+	).Methods("POST")
+
+	// Comments
+	router.Handle("/files/{fileId}/rows/{rowId}/comments",
+		middlewares.JwtFilter(http.HandlerFunc(core.GetRowComments)),
+	).Methods("GET")
+	router.Handle("/files/{fileId}/rows/{rowId}/comments",
+		middlewares.JwtFilter(http.HandlerFunc(core.CreateComment)),
+	).Methods("POST")
+	router.Handle("/files/{id}/comments",
+		middlewares.JwtFilter(http.HandlerFunc(core.GetFileThreads)),
+	).Methods("GET")
+	router.Handle("/files/{id}/comments/{commentId}",
+		middlewares.JwtFilter(http.HandlerFunc(core.UpdateComment)),
+	).Methods("PUT")
+	router.Handle("/files/{id}/comments/{commentId}",
+		middlewares.JwtFilter(http.HandlerFunc(core.DeleteComment)),
+	).Methods("DELETE")
+	router.Handle("/files/{id}/comments/{commentId}/resolved",
+		middlewares.JwtFilter(http.HandlerFunc(core.ResolveThread)),
+	).Methods("PUT")
+
+	// Labels
+	router.Handle("/files/{id}/labels",
+		middlewares.JwtFilter(http.HandlerFunc(core.GetLabels)),
+	).Methods("GET")
+	router.Handle("/files/{id}/labels",
+		middlewares.JwtFilter(http.HandlerFunc(core.CreateLabel)),
+	).Methods("POST")
+	router.Handle("/files/{id}/labels/{labelId}",
+		middlewares.JwtFilter(http.HandlerFunc(core.UpdateLabel)),
+	).Methods("PUT")
+	router.Handle("/files/{id}/labels/{labelId}",
+		middlewares.JwtFilter(http.HandlerFunc(core.DeleteLabel)),
+	).Methods("DELETE")
+	router.Handle("/files/{id}/labels/{labelId}/rows",
+		middlewares.JwtFilter(http.HandlerFunc(core.AttachLabel)),
+	).Methods("POST")
+	router.Handle("/files/{id}/labels/{labelId}/rows",
+		middlewares.JwtFilter(http.HandlerFunc(core.DetachLabel)),
+	).Methods("DELETE")
+
+	// Undo/redo
+	router.Handle("/files/{id}/undo",
+		middlewares.JwtFilter(http.HandlerFunc(core.Undo)),
+	).Methods("POST")
+	router.Handle("/files/{id}/redo",
+		middlewares.JwtFilter(http.HandlerFunc(core.Redo)),
+	).Methods("POST")
+
+	// Search
+	router.Handle("/search",
+		middlewares.JwtFilter(http.HandlerFunc(core.Search)),
+	).Methods("GET")
+
+	// Trash
+	router.Handle("/trash",
+		middlewares.JwtFilter(http.HandlerFunc(core.GetTrash)),
+	).Methods("GET")
+	router.Handle("/trash",
+		middlewares.JwtFilter(http.HandlerFunc(core.PurgeTrash)),
+	).Methods("DELETE")
+	router.Handle("/trash/restore",
+		middlewares.JwtFilter(http.HandlerFunc(core.RestoreTrash)),
+	).Methods("POST")
+
+	// Maintenance
+	router.Handle("/files/{id}/rebalance",
+		middlewares.JwtFilter(http.HandlerFunc(core.RebalanceFile)),
+	).Methods("POST")
+
 	// Global OPTIONS handler for CORS preflight
 	router.Methods("OPTIONS").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -11,7 +11,9 @@ func HandleError(e error, w http.ResponseWriter) {
 
 	w.Header().Set("Content-type","application/json")
 
-	switch e.(type) {
+	var body any
+
+	switch e := e.(type) {
 	case *runtime_errors.InternalServerError:
 		w.WriteHeader(http.StatusInternalServerError)
 
@@ -21,6 +23,19 @@ func HandleError(e error, w http.ResponseWriter) {
 	
 	case *runtime_errors.UnauthorizedError:
 		w.WriteHeader(http.StatusUnauthorized)
+
+	case *runtime_errors.ForbiddenError:
+		w.WriteHeader(http.StatusForbidden)
+
+	case *runtime_errors.NotFoundError:
+		w.WriteHeader(http.StatusNotFound)
+
+	case *runtime_errors.ConflictError:
+		w.WriteHeader(http.StatusConflict)
+		body = e.Current
+
+	case *runtime_errors.PreconditionRequiredError:
+		w.WriteHeader(http.StatusPreconditionRequired)
 	
 	default:
 		w.WriteHeader(http.StatusBadRequest)
@@ -30,5 +45,6 @@ func HandleError(e error, w http.ResponseWriter) {
 	json.NewEncoder(w).Encode(models.ResponseModel{
 		Success: false,
 		Message: "Operation Failed: "+e.Error(),
+		Body: body,
 	})
 }
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_csv_rows_file_rank;
+ALTER TABLE csv_rows DROP COLUMN IF EXISTS rank;
@@ -0,0 +1,16 @@
+-- lexicographic ordering key, compared byte-wise (see internal/lexorank)
+ALTER TABLE csv_rows ADD COLUMN rank TEXT COLLATE "C";
+
+-- seed existing rows in their current position order, same format as lexorank.Ordinal
+UPDATE csv_rows r
+SET rank = lpad(to_hex(o.ordinal), 8, '0') || 'V'
+FROM (
+  SELECT id, ROW_NUMBER() OVER (PARTITION BY csv_file_id ORDER BY position, id) AS ordinal
+  FROM csv_rows
+) o
+WHERE r.id = o.id;
+
+ALTER TABLE csv_rows ALTER COLUMN rank SET NOT NULL;
+
+-- index to quickly fetch rows in rank order
+CREATE INDEX idx_csv_rows_file_rank ON csv_rows(csv_file_id, rank);
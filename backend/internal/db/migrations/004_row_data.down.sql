@@ -0,0 +1 @@
+ALTER TABLE csv_rows DROP COLUMN IF EXISTS data;
@@ -0,0 +1,2 @@
+-- all columns of the source record, keyed by header name
+ALTER TABLE csv_rows ADD COLUMN data JSONB;
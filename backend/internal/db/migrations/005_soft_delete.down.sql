@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_csv_rows_deleted_at;
+DROP INDEX IF EXISTS idx_csv_table_deleted_at;
+ALTER TABLE csv_rows DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE csv_table DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,7 @@
+-- trashed files and rows are hidden from every read path until purged
+ALTER TABLE csv_table ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE csv_rows ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- indexes for listing and purging the trash
+CREATE INDEX idx_csv_table_deleted_at ON csv_table(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_csv_rows_deleted_at ON csv_rows(deleted_at) WHERE deleted_at IS NOT NULL;
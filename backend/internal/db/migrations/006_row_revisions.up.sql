@@ -0,0 +1,18 @@
+-- append-only history of row edits
+CREATE TABLE csv_row_revisions (
+  id BIGSERIAL PRIMARY KEY,
+  row_id BIGINT NOT NULL REFERENCES csv_rows(id) ON DELETE CASCADE,
+  csv_file_id BIGINT NOT NULL REFERENCES csv_table(id) ON DELETE CASCADE,
+  changed_by INT REFERENCES user_table(id),
+  action VARCHAR(20) NOT NULL,           -- update, move, restore
+  old_text TEXT NOT NULL,
+  new_text TEXT NOT NULL,
+  old_position NUMERIC(30,10) NOT NULL,
+  new_position NUMERIC(30,10) NOT NULL,
+  old_rank TEXT COLLATE "C" NOT NULL,
+  new_rank TEXT COLLATE "C" NOT NULL,
+  changed_at TIMESTAMPTZ DEFAULT now()
+);
+
+-- index to list a row's history newest first
+CREATE INDEX idx_csv_row_revisions_row ON csv_row_revisions(row_id, id);
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS trg_csv_table_operation_log ON csv_table;
+DROP TRIGGER IF EXISTS trg_csv_rows_operation_log ON csv_rows;
+DROP FUNCTION IF EXISTS record_csv_file_change();
+DROP FUNCTION IF EXISTS record_csv_row_change();
+DROP FUNCTION IF EXISTS csv_file_state(csv_table);
+DROP FUNCTION IF EXISTS csv_row_state(csv_rows);
+DROP TABLE IF EXISTS csv_operation_rows;
+DROP TABLE IF EXISTS csv_operations;
@@ -0,0 +1,96 @@
+-- one entry per undoable user action on a file
+CREATE TABLE csv_operations (
+  id BIGSERIAL PRIMARY KEY,
+  csv_file_id BIGINT NOT NULL REFERENCES csv_table(id) ON DELETE CASCADE,
+  user_id INT NOT NULL REFERENCES user_table(id),
+  kind VARCHAR(30) NOT NULL,
+  file_before JSONB,                     -- file state before/after, if the file itself changed
+  file_after JSONB,
+  undone BOOLEAN NOT NULL DEFAULT false,
+  created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX idx_csv_operations_file_user ON csv_operations(csv_file_id, user_id, id);
+
+-- row states before/after each operation; NULL before means the operation created the row
+CREATE TABLE csv_operation_rows (
+  operation_id BIGINT NOT NULL REFERENCES csv_operations(id) ON DELETE CASCADE,
+  row_id BIGINT NOT NULL,
+  before_state JSONB,
+  after_state JSONB,
+  PRIMARY KEY (operation_id, row_id)
+);
+
+CREATE FUNCTION csv_row_state(r csv_rows) RETURNS JSONB AS $$
+  SELECT jsonb_build_object(
+    'position', r.position,
+    'rank', r.rank,
+    'input_text', r.input_text,
+    'data', r.data,
+    'deleted', r.deleted_at IS NOT NULL
+  )
+$$ LANGUAGE SQL STABLE;
+
+CREATE FUNCTION csv_file_state(f csv_table) RETURNS JSONB AS $$
+  SELECT jsonb_build_object(
+    'file_name', f.file_name,
+    'deleted', f.deleted_at IS NOT NULL
+  )
+$$ LANGUAGE SQL STABLE;
+
+-- The services set uptexty.operation_id for the current transaction; every
+-- change made while it is set is logged against that operation. The first
+-- before state of a row is kept, the after state follows the last change.
+CREATE FUNCTION record_csv_row_change() RETURNS trigger AS $$
+DECLARE
+  op_id BIGINT := NULLIF(current_setting('uptexty.operation_id', true), '')::BIGINT;
+BEGIN
+  IF op_id IS NULL THEN
+    RETURN NULL;
+  END IF;
+
+  IF TG_OP = 'INSERT' THEN
+    INSERT INTO csv_operation_rows (operation_id, row_id, before_state, after_state)
+    VALUES (op_id, NEW.id, NULL, csv_row_state(NEW))
+    ON CONFLICT (operation_id, row_id) DO UPDATE SET after_state = EXCLUDED.after_state;
+  ELSIF TG_OP = 'UPDATE' THEN
+    IF csv_row_state(OLD) = csv_row_state(NEW) THEN
+      RETURN NULL;
+    END IF;
+    INSERT INTO csv_operation_rows (operation_id, row_id, before_state, after_state)
+    VALUES (op_id, NEW.id, csv_row_state(OLD), csv_row_state(NEW))
+    ON CONFLICT (operation_id, row_id) DO UPDATE SET after_state = EXCLUDED.after_state;
+  ELSE
+    INSERT INTO csv_operation_rows (operation_id, row_id, before_state, after_state)
+    VALUES (op_id, OLD.id, csv_row_state(OLD), NULL)
+    ON CONFLICT (operation_id, row_id) DO UPDATE SET after_state = NULL;
+  END IF;
+
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_csv_rows_operation_log
+AFTER INSERT OR UPDATE OR DELETE ON csv_rows
+FOR EACH ROW EXECUTE FUNCTION record_csv_row_change();
+
+CREATE FUNCTION record_csv_file_change() RETURNS trigger AS $$
+DECLARE
+  op_id BIGINT := NULLIF(current_setting('uptexty.operation_id', true), '')::BIGINT;
+BEGIN
+  IF op_id IS NULL OR csv_file_state(OLD) = csv_file_state(NEW) THEN
+    RETURN NULL;
+  END IF;
+
+  UPDATE csv_operations
+  SET file_before = COALESCE(file_before, csv_file_state(OLD)),
+      file_after = csv_file_state(NEW)
+  WHERE id = op_id AND csv_file_id = NEW.id;
+
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_csv_table_operation_log
+AFTER UPDATE ON csv_table
+FOR EACH ROW EXECUTE FUNCTION record_csv_file_change();
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS trg_csv_rows_version ON csv_rows;
+DROP FUNCTION IF EXISTS bump_csv_row_version();
+ALTER TABLE csv_rows DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE csv_rows DROP COLUMN IF EXISTS version;
@@ -0,0 +1,17 @@
+-- optimistic concurrency: version is bumped on every real change to a row
+ALTER TABLE csv_rows ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE csv_rows ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE FUNCTION bump_csv_row_version() RETURNS trigger AS $$
+BEGIN
+  IF csv_row_state(OLD) IS DISTINCT FROM csv_row_state(NEW) THEN
+    NEW.version := OLD.version + 1;
+    NEW.updated_at := now();
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_csv_rows_version
+BEFORE UPDATE ON csv_rows
+FOR EACH ROW EXECUTE FUNCTION bump_csv_row_version();
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS csv_row_labels;
+DROP TABLE IF EXISTS csv_labels;
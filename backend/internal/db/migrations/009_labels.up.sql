@@ -0,0 +1,21 @@
+-- label definitions, scoped to a file
+CREATE TABLE csv_labels (
+  id BIGSERIAL PRIMARY KEY,
+  csv_file_id BIGINT NOT NULL REFERENCES csv_table(id) ON DELETE CASCADE,
+  name VARCHAR(100) NOT NULL,
+  color VARCHAR(20) NOT NULL DEFAULT '',
+  is_status BOOLEAN NOT NULL DEFAULT false,   -- a row carries at most one status label
+  created_at TIMESTAMPTZ DEFAULT now(),
+  UNIQUE (csv_file_id, name)
+);
+
+CREATE TABLE csv_row_labels (
+  row_id BIGINT NOT NULL REFERENCES csv_rows(id) ON DELETE CASCADE,
+  label_id BIGINT NOT NULL REFERENCES csv_labels(id) ON DELETE CASCADE,
+  labelled_by INT REFERENCES user_table(id),
+  labelled_at TIMESTAMPTZ DEFAULT now(),
+  PRIMARY KEY (row_id, label_id)
+);
+
+-- index to filter rows by label
+CREATE INDEX idx_csv_row_labels_label ON csv_row_labels(label_id, row_id);
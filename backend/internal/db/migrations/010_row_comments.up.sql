@@ -0,0 +1,15 @@
+-- comment threads on rows; a thread is a top-level comment and its replies
+CREATE TABLE csv_row_comments (
+  id BIGSERIAL PRIMARY KEY,
+  row_id BIGINT NOT NULL REFERENCES csv_rows(id) ON DELETE CASCADE,
+  parent_id BIGINT REFERENCES csv_row_comments(id) ON DELETE CASCADE,  -- NULL for the thread's first comment
+  author_id INT REFERENCES user_table(id) ON DELETE SET NULL,
+  body TEXT NOT NULL,
+  resolved_at TIMESTAMPTZ,      -- set on the first comment only
+  resolved_by INT REFERENCES user_table(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ DEFAULT now(),
+  updated_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX idx_csv_row_comments_row ON csv_row_comments(row_id, id);
+CREATE INDEX idx_csv_row_comments_parent ON csv_row_comments(parent_id);
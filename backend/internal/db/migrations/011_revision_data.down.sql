@@ -0,0 +1,2 @@
+ALTER TABLE csv_row_revisions DROP COLUMN IF EXISTS new_data;
+ALTER TABLE csv_row_revisions DROP COLUMN IF EXISTS old_data;
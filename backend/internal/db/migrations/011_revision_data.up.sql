@@ -0,0 +1,4 @@
+-- revisions also record edits to the row's data columns; NULL when the
+-- revision left data unchanged
+ALTER TABLE csv_row_revisions ADD COLUMN old_data JSONB;
+ALTER TABLE csv_row_revisions ADD COLUMN new_data JSONB;
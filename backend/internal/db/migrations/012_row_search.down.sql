@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_csv_rows_search_vector;
+DROP TRIGGER IF EXISTS trg_csv_rows_search_vector ON csv_rows;
+DROP FUNCTION IF EXISTS update_csv_row_search_vector();
+ALTER TABLE csv_rows DROP COLUMN IF EXISTS search_vector;
+DROP FUNCTION IF EXISTS csv_row_search_text(TEXT, JSONB);
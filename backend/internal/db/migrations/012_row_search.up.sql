@@ -0,0 +1,21 @@
+-- full-text search over a row's text and data columns
+CREATE FUNCTION csv_row_search_text(input_text TEXT, data JSONB) RETURNS TEXT AS $$
+  SELECT concat_ws(' ', input_text, (SELECT string_agg(value, ' ') FROM jsonb_each_text(data)))
+$$ LANGUAGE SQL IMMUTABLE;
+
+ALTER TABLE csv_rows ADD COLUMN search_vector TSVECTOR;
+
+CREATE FUNCTION update_csv_row_search_vector() RETURNS trigger AS $$
+BEGIN
+  NEW.search_vector := to_tsvector('english', csv_row_search_text(NEW.input_text, NEW.data));
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_csv_rows_search_vector
+BEFORE INSERT OR UPDATE OF input_text, data ON csv_rows
+FOR EACH ROW EXECUTE FUNCTION update_csv_row_search_vector();
+
+UPDATE csv_rows SET search_vector = to_tsvector('english', csv_row_search_text(input_text, data));
+
+CREATE INDEX idx_csv_rows_search_vector ON csv_rows USING GIN (search_vector);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_csv_rows_input_text_trgm;
+-- pg_trgm is left installed; other databases objects may depend on it
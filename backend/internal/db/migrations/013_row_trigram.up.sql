@@ -0,0 +1,4 @@
+-- trigram index for substring and fuzzy matching on row text
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_csv_rows_input_text_trgm ON csv_rows USING GIN (input_text gin_trgm_ops);
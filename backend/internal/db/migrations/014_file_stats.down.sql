@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS trg_csv_rows_stats_delete ON csv_rows;
+DROP TRIGGER IF EXISTS trg_csv_rows_stats_update ON csv_rows;
+DROP TRIGGER IF EXISTS trg_csv_rows_stats_insert ON csv_rows;
+DROP FUNCTION IF EXISTS invalidate_csv_file_stats();
+DROP TABLE IF EXISTS csv_file_stats;
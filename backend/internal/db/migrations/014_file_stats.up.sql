@@ -0,0 +1,33 @@
+-- cached per-file statistics, dropped whenever the file's rows change
+CREATE TABLE csv_file_stats (
+  csv_file_id BIGINT PRIMARY KEY REFERENCES csv_table(id) ON DELETE CASCADE,
+  stats JSONB NOT NULL,
+  computed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE FUNCTION invalidate_csv_file_stats() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    DELETE FROM csv_file_stats WHERE csv_file_id IN (SELECT csv_file_id FROM old_rows);
+  ELSE
+    DELETE FROM csv_file_stats WHERE csv_file_id IN (SELECT csv_file_id FROM new_rows);
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- transition tables allow only one event per trigger
+CREATE TRIGGER trg_csv_rows_stats_insert
+AFTER INSERT ON csv_rows
+REFERENCING NEW TABLE AS new_rows
+FOR EACH STATEMENT EXECUTE FUNCTION invalidate_csv_file_stats();
+
+CREATE TRIGGER trg_csv_rows_stats_update
+AFTER UPDATE ON csv_rows
+REFERENCING NEW TABLE AS new_rows
+FOR EACH STATEMENT EXECUTE FUNCTION invalidate_csv_file_stats();
+
+CREATE TRIGGER trg_csv_rows_stats_delete
+AFTER DELETE ON csv_rows
+REFERENCING OLD TABLE AS old_rows
+FOR EACH STATEMENT EXECUTE FUNCTION invalidate_csv_file_stats();
@@ -0,0 +1,12 @@
+DROP TRIGGER IF EXISTS trg_csv_table_touch_rename ON csv_table;
+DROP FUNCTION IF EXISTS touch_renamed_csv_file();
+DROP TRIGGER IF EXISTS trg_csv_labels_touch_delete ON csv_labels;
+DROP TRIGGER IF EXISTS trg_csv_row_labels_touch_delete ON csv_row_labels;
+DROP TRIGGER IF EXISTS trg_csv_row_labels_touch_insert ON csv_row_labels;
+DROP FUNCTION IF EXISTS touch_csv_files_for_labels();
+DROP TRIGGER IF EXISTS trg_csv_rows_touch_delete ON csv_rows;
+DROP TRIGGER IF EXISTS trg_csv_rows_touch_update ON csv_rows;
+DROP TRIGGER IF EXISTS trg_csv_rows_touch_insert ON csv_rows;
+DROP FUNCTION IF EXISTS touch_csv_files();
+ALTER TABLE csv_table DROP COLUMN IF EXISTS modified_at;
+ALTER TABLE csv_table DROP COLUMN IF EXISTS change_count;
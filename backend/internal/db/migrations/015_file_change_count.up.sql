@@ -0,0 +1,77 @@
+-- per-file change counter for ETags and conditional GETs; bumped by every
+-- statement that changes the file's rows or row labels, or renames it
+ALTER TABLE csv_table ADD COLUMN change_count BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE csv_table ADD COLUMN modified_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+UPDATE csv_table SET modified_at = uploaded_at WHERE uploaded_at IS NOT NULL;
+
+CREATE FUNCTION touch_csv_files() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    UPDATE csv_table SET change_count = change_count + 1, modified_at = now()
+    WHERE id IN (SELECT csv_file_id FROM old_rows);
+  ELSE
+    UPDATE csv_table SET change_count = change_count + 1, modified_at = now()
+    WHERE id IN (SELECT csv_file_id FROM new_rows);
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_csv_rows_touch_insert
+AFTER INSERT ON csv_rows
+REFERENCING NEW TABLE AS new_rows
+FOR EACH STATEMENT EXECUTE FUNCTION touch_csv_files();
+
+CREATE TRIGGER trg_csv_rows_touch_update
+AFTER UPDATE ON csv_rows
+REFERENCING NEW TABLE AS new_rows
+FOR EACH STATEMENT EXECUTE FUNCTION touch_csv_files();
+
+CREATE TRIGGER trg_csv_rows_touch_delete
+AFTER DELETE ON csv_rows
+REFERENCING OLD TABLE AS old_rows
+FOR EACH STATEMENT EXECUTE FUNCTION touch_csv_files();
+
+-- row labels are listed with the rows, so they count as row changes
+CREATE FUNCTION touch_csv_files_for_labels() RETURNS trigger AS $$
+BEGIN
+  UPDATE csv_table SET change_count = change_count + 1, modified_at = now()
+  WHERE id IN (
+    SELECT l.csv_file_id FROM csv_labels l
+    WHERE l.id IN (SELECT label_id FROM changed_labels)
+  );
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_csv_row_labels_touch_insert
+AFTER INSERT ON csv_row_labels
+REFERENCING NEW TABLE AS changed_labels
+FOR EACH STATEMENT EXECUTE FUNCTION touch_csv_files_for_labels();
+
+CREATE TRIGGER trg_csv_row_labels_touch_delete
+AFTER DELETE ON csv_row_labels
+REFERENCING OLD TABLE AS changed_labels
+FOR EACH STATEMENT EXECUTE FUNCTION touch_csv_files_for_labels();
+
+-- deleting a label removes it from rows by cascade, after which the
+-- csv_row_labels trigger can no longer find the label's file
+CREATE TRIGGER trg_csv_labels_touch_delete
+AFTER DELETE ON csv_labels
+REFERENCING OLD TABLE AS old_rows
+FOR EACH STATEMENT EXECUTE FUNCTION touch_csv_files();
+
+CREATE FUNCTION touch_renamed_csv_file() RETURNS trigger AS $$
+BEGIN
+  IF NEW.file_name IS DISTINCT FROM OLD.file_name THEN
+    NEW.change_count := OLD.change_count + 1;
+    NEW.modified_at := now();
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_csv_table_touch_rename
+BEFORE UPDATE ON csv_table
+FOR EACH ROW EXECUTE FUNCTION touch_renamed_csv_file();
@@ -0,0 +1,11 @@
+-- train/validation/test style splits of a file, kept so they can be redone
+CREATE TABLE csv_splits (
+  id BIGSERIAL PRIMARY KEY,
+  csv_file_id BIGINT NOT NULL REFERENCES csv_table(id) ON DELETE CASCADE,
+  created_by INT REFERENCES user_table(id),
+  params JSONB NOT NULL,        -- the request, including the seed used
+  partitions JSONB NOT NULL,    -- name, ratio, row count and saved file per partition
+  created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE INDEX idx_csv_splits_file ON csv_splits(csv_file_id, id);
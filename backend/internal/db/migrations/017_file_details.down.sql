@@ -0,0 +1,27 @@
+CREATE OR REPLACE FUNCTION touch_renamed_csv_file() RETURNS trigger AS $$
+BEGIN
+  IF NEW.file_name IS DISTINCT FROM OLD.file_name THEN
+    NEW.change_count := OLD.change_count + 1;
+    NEW.modified_at := now();
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+UPDATE csv_operations
+SET file_after = file_after - 'description' - 'metadata'
+WHERE file_after IS NOT NULL;
+
+UPDATE csv_operations
+SET file_before = file_before - 'description' - 'metadata'
+WHERE file_before IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION csv_file_state(f csv_table) RETURNS JSONB AS $$
+  SELECT jsonb_build_object(
+    'file_name', f.file_name,
+    'deleted', f.deleted_at IS NOT NULL
+  )
+$$ LANGUAGE SQL STABLE;
+
+ALTER TABLE csv_table DROP COLUMN IF EXISTS metadata;
+ALTER TABLE csv_table DROP COLUMN IF EXISTS description;
@@ -0,0 +1,36 @@
+-- free-form description and custom metadata, set with PATCH /files/{id}
+ALTER TABLE csv_table ADD COLUMN description TEXT;
+ALTER TABLE csv_table ADD COLUMN metadata JSONB NOT NULL DEFAULT '{}';
+
+-- both are part of the file state, so changing them can be undone
+CREATE OR REPLACE FUNCTION csv_file_state(f csv_table) RETURNS JSONB AS $$
+  SELECT jsonb_build_object(
+    'file_name', f.file_name,
+    'description', f.description,
+    'metadata', f.metadata,
+    'deleted', f.deleted_at IS NOT NULL
+  )
+$$ LANGUAGE SQL STABLE;
+
+-- states logged before now match the new shape, so replaying them neither
+-- conflicts nor clears the new columns
+UPDATE csv_operations
+SET file_before = file_before || '{"description": null, "metadata": {}}'
+WHERE file_before IS NOT NULL;
+
+UPDATE csv_operations
+SET file_after = file_after || '{"description": null, "metadata": {}}'
+WHERE file_after IS NOT NULL;
+
+-- they are listed with the file, so they count as changes like a rename
+CREATE OR REPLACE FUNCTION touch_renamed_csv_file() RETURNS trigger AS $$
+BEGIN
+  IF NEW.file_name IS DISTINCT FROM OLD.file_name
+    OR NEW.description IS DISTINCT FROM OLD.description
+    OR NEW.metadata IS DISTINCT FROM OLD.metadata THEN
+    NEW.change_count := OLD.change_count + 1;
+    NEW.modified_at := now();
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
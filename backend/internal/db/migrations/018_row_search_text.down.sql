@@ -0,0 +1,5 @@
+CREATE OR REPLACE FUNCTION csv_row_search_text(input_text TEXT, data JSONB) RETURNS TEXT AS $$
+  SELECT concat_ws(' ', input_text, (SELECT string_agg(value, ' ') FROM jsonb_each_text(data)))
+$$ LANGUAGE SQL IMMUTABLE;
+
+UPDATE csv_rows SET search_vector = to_tsvector('english', csv_row_search_text(input_text, data));
@@ -0,0 +1,8 @@
+-- data usually repeats input_text as one of its columns, which made every
+-- word in it match and show twice; data values equal to the text are skipped
+CREATE OR REPLACE FUNCTION csv_row_search_text(input_text TEXT, data JSONB) RETURNS TEXT AS $$
+  SELECT concat_ws(' ', input_text,
+    (SELECT string_agg(value, ' ') FROM jsonb_each_text(data) WHERE value IS DISTINCT FROM input_text))
+$$ LANGUAGE SQL IMMUTABLE;
+
+UPDATE csv_rows SET search_vector = to_tsvector('english', csv_row_search_text(input_text, data));
@@ -0,0 +1,38 @@
+CREATE OR REPLACE FUNCTION touch_renamed_csv_file() RETURNS trigger AS $$
+BEGIN
+  IF NEW.file_name IS DISTINCT FROM OLD.file_name
+    OR NEW.description IS DISTINCT FROM OLD.description
+    OR NEW.metadata IS DISTINCT FROM OLD.metadata THEN
+    NEW.change_count := OLD.change_count + 1;
+    NEW.modified_at := now();
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION touch_csv_files_for_labels() RETURNS trigger AS $$
+BEGIN
+  UPDATE csv_table SET change_count = change_count + 1, modified_at = now()
+  WHERE id IN (
+    SELECT l.csv_file_id FROM csv_labels l
+    WHERE l.id IN (SELECT label_id FROM changed_labels)
+  );
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION touch_csv_files() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    UPDATE csv_table SET change_count = change_count + 1, modified_at = now()
+    WHERE id IN (SELECT csv_file_id FROM old_rows);
+  ELSE
+    UPDATE csv_table SET change_count = change_count + 1, modified_at = now()
+    WHERE id IN (SELECT csv_file_id FROM new_rows);
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_csv_labels_touch_rename ON csv_labels;
+DROP FUNCTION IF EXISTS touch_csv_files_for_renamed_labels();
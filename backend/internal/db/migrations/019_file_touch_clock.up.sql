@@ -0,0 +1,57 @@
+-- label filters match on names, so renaming a label changes filtered
+-- listings; UPDATE triggers with a column list cannot have transition
+-- tables, so the function compares the names itself
+CREATE FUNCTION touch_csv_files_for_renamed_labels() RETURNS trigger AS $$
+BEGIN
+  UPDATE csv_table SET change_count = change_count + 1, modified_at = clock_timestamp()
+  WHERE id IN (
+    SELECT n.csv_file_id FROM new_labels n
+    JOIN old_labels o ON o.id = n.id
+    WHERE n.name IS DISTINCT FROM o.name
+  );
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_csv_labels_touch_rename
+AFTER UPDATE ON csv_labels
+REFERENCING OLD TABLE AS old_labels NEW TABLE AS new_labels
+FOR EACH STATEMENT EXECUTE FUNCTION touch_csv_files_for_renamed_labels();
+
+-- now() is the transaction start, which can be seconds before the change
+-- commits; Last-Modified needs the time the change was made
+CREATE OR REPLACE FUNCTION touch_csv_files() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    UPDATE csv_table SET change_count = change_count + 1, modified_at = clock_timestamp()
+    WHERE id IN (SELECT csv_file_id FROM old_rows);
+  ELSE
+    UPDATE csv_table SET change_count = change_count + 1, modified_at = clock_timestamp()
+    WHERE id IN (SELECT csv_file_id FROM new_rows);
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION touch_csv_files_for_labels() RETURNS trigger AS $$
+BEGIN
+  UPDATE csv_table SET change_count = change_count + 1, modified_at = clock_timestamp()
+  WHERE id IN (
+    SELECT l.csv_file_id FROM csv_labels l
+    WHERE l.id IN (SELECT label_id FROM changed_labels)
+  );
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION touch_renamed_csv_file() RETURNS trigger AS $$
+BEGIN
+  IF NEW.file_name IS DISTINCT FROM OLD.file_name
+    OR NEW.description IS DISTINCT FROM OLD.description
+    OR NEW.metadata IS DISTINCT FROM OLD.metadata THEN
+    NEW.change_count := OLD.change_count + 1;
+    NEW.modified_at := clock_timestamp();
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
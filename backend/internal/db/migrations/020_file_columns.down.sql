@@ -0,0 +1 @@
+ALTER TABLE csv_table DROP COLUMN IF EXISTS column_names;
@@ -0,0 +1,3 @@
+-- the CSV header in upload order, so exports can write the columns back
+-- the way they came; NULL for files uploaded before it was kept
+ALTER TABLE csv_table ADD COLUMN column_names TEXT[];
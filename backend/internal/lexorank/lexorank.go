@@ -0,0 +1,150 @@
+// Package lexorank generates string ordering keys that sort correctly under
+// byte-wise (COLLATE "C") comparison. A key is read as a base-62 fraction in
+// (0, 1), so there is always room for another key between any two
+// neighbours and inserting a row never requires renumbering the others.
+package lexorank
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// digits is the key alphabet in ascending byte order.
+const digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var (
+	ErrInvalidKey = errors.New("invalid rank key")
+	ErrOutOfOrder = errors.New("rank keys are out of order")
+)
+
+// Validate reports whether key is a well-formed rank. Keys must be non-empty,
+// use only the base-62 alphabet and must not end in '0', otherwise there
+// would be no key directly before them.
+func Validate(key string) error {
+	if key == "" {
+		return fmt.Errorf("%w: empty key", ErrInvalidKey)
+	}
+
+	for _, c := range key {
+		if !strings.ContainsRune(digits, c) {
+			return fmt.Errorf("%w: %q contains %q", ErrInvalidKey, key, c)
+		}
+	}
+
+	if key[len(key)-1] == digits[0] {
+		return fmt.Errorf("%w: %q ends with %q", ErrInvalidKey, key, digits[0])
+	}
+
+	return nil
+}
+
+// Between returns a key that sorts strictly after prev and strictly before
+// next. An empty prev means "before everything", an empty next means "after
+// everything".
+func Between(prev, next string) (string, error) {
+	if prev != "" {
+		if err := Validate(prev); err != nil {
+			return "", err
+		}
+	}
+	if next != "" {
+		if err := Validate(next); err != nil {
+			return "", err
+		}
+	}
+	if prev != "" && next != "" && prev >= next {
+		return "", fmt.Errorf("%w: %q >= %q", ErrOutOfOrder, prev, next)
+	}
+
+	return midpoint(prev, next, next == ""), nil
+}
+
+// BetweenN returns n ascending keys between prev and next, spread by
+// bisection so key length grows with log(n) rather than n.
+func BetweenN(prev, next string, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	mid, err := Between(prev, next)
+	if err != nil {
+		return nil, err
+	}
+
+	left, err := BetweenN(prev, mid, (n-1)/2)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := BetweenN(mid, next, n-1-(n-1)/2)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, n)
+	keys = append(keys, left...)
+	keys = append(keys, mid)
+	return append(keys, right...), nil
+}
+
+// Ordinal returns the evenly spaced key for the i-th row (1-based) of a
+// freshly numbered file. The database migrations and rebalancing use the
+// same format: eight hex digits followed by 'V'.
+func Ordinal(i int) string {
+	return fmt.Sprintf("%08x", i) + "V"
+}
+
+// midpoint assumes both keys are valid and prev < next. An empty next stands
+// for 1.0. When appending is set the caller asked for a key after everything,
+// so the key is placed just after prev instead of halfway to the end; this
+// keeps keys short for long runs of appends.
+func midpoint(prev, next string, appending bool) string {
+	if next != "" {
+		// Skip the common prefix, padding prev with zeros as we go.
+		n := 0
+		for n < len(next) && digitAt(prev, n) == next[n] {
+			n++
+		}
+		if n > 0 {
+			return next[:n] + midpoint(trimPrefix(prev, n), next[n:], false)
+		}
+	}
+
+	lo := 0
+	if prev != "" {
+		lo = strings.IndexByte(digits, prev[0])
+	}
+	hi := len(digits)
+	if next != "" {
+		hi = strings.IndexByte(digits, next[0])
+	}
+
+	if hi-lo > 1 {
+		if appending {
+			return string(digits[lo+1])
+		}
+		return string(digits[(lo+hi+1)/2])
+	}
+
+	// The first digits are consecutive.
+	if len(next) > 1 {
+		return next[:1]
+	}
+
+	return string(digits[lo]) + midpoint(trimPrefix(prev, 1), "", appending)
+}
+
+func digitAt(key string, i int) byte {
+	if i < len(key) {
+		return key[i]
+	}
+	return digits[0]
+}
+
+func trimPrefix(key string, n int) string {
+	if n >= len(key) {
+		return ""
+	}
+	return key[n:]
+}
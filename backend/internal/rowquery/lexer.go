@@ -0,0 +1,143 @@
+package rowquery
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokName // `quoted name`
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+	tokDot
+	tokComma
+	tokMinus
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of input"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// keyword reports whether t is the given case-insensitive keyword.
+func (t token) keyword(word string) bool {
+	return t.kind == tokIdent && strings.EqualFold(t.text, word)
+}
+
+func lex(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		start := i
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+			continue
+
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", start})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", start})
+			i++
+		case c == '.':
+			tokens = append(tokens, token{tokDot, ".", start})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", start})
+			i++
+
+		case c == '=' || c == '~':
+			tokens = append(tokens, token{tokOp, string(c), start})
+			i++
+		case c == '!' || c == '<' || c == '>':
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				tokens = append(tokens, token{tokOp, string(c) + "=", start})
+				i += 2
+			} else if c == '!' {
+				return nil, fmt.Errorf("unexpected %q at %d", c, start)
+			} else {
+				tokens = append(tokens, token{tokOp, string(c), start})
+				i++
+			}
+
+		case c == '"' || c == '\'' || c == '`':
+			text, end, err := lexQuoted(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			kind := tokString
+			if c == '`' {
+				kind = tokName
+			}
+			tokens = append(tokens, token{kind, text, start})
+			i = end
+
+		case c == '-' && (i+1 >= len(runes) || !unicode.IsDigit(runes[i+1])):
+			tokens = append(tokens, token{tokMinus, "-", start})
+			i++
+
+		case c == '-' || unicode.IsDigit(c):
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokNumber, string(runes[start:i]), start})
+
+		case c == '_' || unicode.IsLetter(c):
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, string(runes[start:i]), start})
+
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", c, start)
+		}
+	}
+
+	return append(tokens, token{tokEOF, "", len(runes)}), nil
+}
+
+// lexQuoted reads a quoted string starting at runes[start]. A backslash
+// escapes the next character. It returns the unquoted text and the index
+// just past the closing quote.
+func lexQuoted(runes []rune, start int) (string, int, error) {
+	quote := runes[start]
+	var b strings.Builder
+
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			i++
+			if i == len(runes) {
+				return "", 0, fmt.Errorf("unterminated string at %d", start)
+			}
+			b.WriteRune(runes[i])
+		case quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteRune(runes[i])
+		}
+	}
+
+	return "", 0, fmt.Errorf("unterminated string at %d", start)
+}
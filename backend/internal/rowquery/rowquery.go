@@ -0,0 +1,416 @@
+// Package rowquery parses the filter and sort expressions accepted by the
+// rows listings and compiles them to parameterized SQL over csv_rows.
+//
+// A filter looks like
+//
+//	score > 3 AND lang = "en" AND NOT (label = "reviewed" OR length < 10)
+//
+// and follows this grammar:
+//
+//	expr       = term { "OR" term }
+//	term       = factor { "AND" factor }
+//	factor     = "NOT" factor | "(" expr ")" | comparison
+//	comparison = field op value | field "IS" [ "NOT" ] "NULL"
+//	op         = "=" | "!=" | "<" | "<=" | ">" | ">=" | "~"
+//	field      = name | "data" "." name
+//	name       = identifier | `quoted name`
+//	value      = number | "string" | 'string'
+//
+// Keywords are case-insensitive and "~" is a case-insensitive substring
+// match. The built-in fields are id, position, text, length, version,
+// label, created_at and updated_at; any other name is a column of the
+// row's data, and data.<name> always is. A data column compared with a
+// number is compared numerically and only matches numeric values.
+//
+// A sort is a comma separated list of fields, each optionally prefixed
+// with "-" for descending. Data columns sort numeric values first, in
+// numeric order, then the rest as text.
+package rowquery
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxLength bounds the length of a filter or sort expression.
+const MaxLength = 4096
+
+// maxDepth bounds how deeply a filter may nest.
+const maxDepth = 32
+
+var ErrSyntax = errors.New("invalid row query")
+
+// SQL is a fragment of SQL with a %s in place of each of its arguments, in
+// order. Literal percent signs are written as %%.
+type SQL struct {
+	Text string
+	Args []any
+}
+
+func (s *SQL) write(text string, args ...any) {
+	s.Text += text
+	s.Args = append(s.Args, args...)
+}
+
+type fieldKind int
+
+const (
+	fieldNumber fieldKind = iota
+	fieldText
+	fieldTime
+	fieldLabel
+	fieldData
+)
+
+type field struct {
+	kind   fieldKind
+	column string // SQL expression, or the data column name for fieldData
+	name   string
+}
+
+var builtins = map[string]field{
+	"id":         {kind: fieldNumber, column: "id"},
+	"position":   {kind: fieldNumber, column: "position"},
+	"length":     {kind: fieldNumber, column: "char_length(input_text)"},
+	"version":    {kind: fieldNumber, column: "version"},
+	"text":       {kind: fieldText, column: "input_text"},
+	"created_at": {kind: fieldTime, column: "created_at"},
+	"updated_at": {kind: fieldTime, column: "updated_at"},
+	"label":      {kind: fieldLabel},
+}
+
+// numericPattern matches data values that are compared and sorted as
+// numbers. Digits and exponent are bounded well inside what NUMERIC
+// accepts, so a value like 1e2000 is treated as text rather than failing
+// the cast.
+const numericPattern = `'^\s*[-+]?([0-9]{1,255}\.?[0-9]{0,255}|\.[0-9]{1,255})([eE][-+]?[0-9]{1,3})?\s*$'`
+
+// dataNumber writes a data column as NUMERIC, or NULL when it is not a
+// number, so a stray non-numeric value never makes the cast fail.
+func dataNumber(s *SQL, column string) {
+	s.write("(CASE WHEN data->>%s::text ~ "+numericPattern+" THEN (data->>%s::text)::numeric END)", column, column)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+func newParser(input string) (*parser, error) {
+	if len(input) > MaxLength {
+		return nil, fmt.Errorf("%w: longer than %d characters", ErrSyntax, MaxLength)
+	}
+
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSyntax, err)
+	}
+	return &parser{tokens: tokens}, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return fmt.Errorf("%w: %s at %d", ErrSyntax, fmt.Sprintf(format, args...), t.pos)
+}
+
+// Filter compiles a filter expression to an SQL condition on csv_rows.
+func Filter(input string) (*SQL, error) {
+	p, err := newParser(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var s SQL
+	if err := p.expr(&s); err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+
+	return &s, nil
+}
+
+func (p *parser) expr(s *SQL) error {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxDepth {
+		return p.errorf(p.peek(), "nested too deeply")
+	}
+
+	s.write("(")
+	if err := p.term(s); err != nil {
+		return err
+	}
+	for p.peek().keyword("OR") {
+		p.next()
+		s.write(" OR ")
+		if err := p.term(s); err != nil {
+			return err
+		}
+	}
+	s.write(")")
+	return nil
+}
+
+func (p *parser) term(s *SQL) error {
+	if err := p.factor(s); err != nil {
+		return err
+	}
+	for p.peek().keyword("AND") {
+		p.next()
+		s.write(" AND ")
+		if err := p.factor(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) factor(s *SQL) error {
+	t := p.peek()
+	switch {
+	case t.keyword("NOT"):
+		p.next()
+		p.depth++
+		defer func() { p.depth-- }()
+		if p.depth > maxDepth {
+			return p.errorf(t, "nested too deeply")
+		}
+		s.write("NOT ")
+		return p.factor(s)
+
+	case t.kind == tokLParen:
+		p.next()
+		if err := p.expr(s); err != nil {
+			return err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return p.errorf(t, "expected ) but found %s", t)
+		}
+		return nil
+
+	default:
+		return p.comparison(s)
+	}
+}
+
+// field reads a field name.
+func (p *parser) field() (field, error) {
+	t := p.next()
+	switch t.kind {
+	case tokName:
+		if f, ok := builtins[t.text]; ok {
+			f.name = t.text
+			return f, nil
+		}
+		return field{kind: fieldData, column: t.text, name: t.text}, nil
+
+	case tokIdent:
+		if strings.EqualFold(t.text, "data") && p.peek().kind == tokDot {
+			p.next()
+			name := p.next()
+			if name.kind != tokIdent && name.kind != tokName {
+				return field{}, p.errorf(name, "expected a column name but found %s", name)
+			}
+			return field{kind: fieldData, column: name.text, name: name.text}, nil
+		}
+		if f, ok := builtins[strings.ToLower(t.text)]; ok {
+			f.name = strings.ToLower(t.text)
+			return f, nil
+		}
+		return field{kind: fieldData, column: t.text, name: t.text}, nil
+
+	default:
+		return field{}, p.errorf(t, "expected a field but found %s", t)
+	}
+}
+
+func (p *parser) comparison(s *SQL) error {
+	f, err := p.field()
+	if err != nil {
+		return err
+	}
+
+	if t := p.peek(); t.keyword("IS") {
+		p.next()
+		negate := p.peek().keyword("NOT")
+		if negate {
+			p.next()
+		}
+		if t := p.next(); !t.keyword("NULL") {
+			return p.errorf(t, "expected NULL but found %s", t)
+		}
+		if f.kind != fieldData {
+			return p.errorf(t, "%s is never null", f.name)
+		}
+		if negate {
+			s.write("data->>%s::text IS NOT NULL", f.column)
+		} else {
+			s.write("data->>%s::text IS NULL", f.column)
+		}
+		return nil
+	}
+
+	opToken := p.next()
+	if opToken.kind != tokOp {
+		return p.errorf(opToken, "expected an operator after %s but found %s", f.name, opToken)
+	}
+	op := opToken.text
+
+	value := p.next()
+	if value.kind != tokString && value.kind != tokNumber {
+		return p.errorf(value, "expected a value but found %s", value)
+	}
+	if value.kind == tokNumber {
+		if _, err := strconv.ParseFloat(value.text, 64); err != nil {
+			return p.errorf(value, "invalid number %s", value)
+		}
+	}
+
+	return compare(s, f, op, value, p)
+}
+
+func compare(s *SQL, f field, op string, value token, p *parser) error {
+	if op == "~" {
+		if value.kind != tokString {
+			return p.errorf(value, "~ needs a string")
+		}
+		switch f.kind {
+		case fieldText:
+			s.write(f.column+" ILIKE %s", LikePattern(value.text))
+		case fieldData:
+			s.write("data->>%s::text ILIKE %s", f.column, LikePattern(value.text))
+		case fieldLabel:
+			s.write("EXISTS (SELECT 1 FROM csv_row_labels rl JOIN csv_labels l ON l.id = rl.label_id"+
+				" WHERE rl.row_id = csv_rows.id AND l.name ILIKE %s)", LikePattern(value.text))
+		default:
+			return p.errorf(value, "~ does not apply to %s", f.name)
+		}
+		return nil
+	}
+
+	sqlOp := op
+	if op == "!=" {
+		sqlOp = "IS DISTINCT FROM"
+	}
+
+	switch f.kind {
+	case fieldNumber:
+		if value.kind != tokNumber {
+			return p.errorf(value, "%s needs a number", f.name)
+		}
+		s.write(f.column+" "+sqlOp+" %s::numeric", value.text)
+
+	case fieldText:
+		if value.kind != tokString {
+			return p.errorf(value, "%s needs a string", f.name)
+		}
+		s.write(f.column+" "+sqlOp+" %s", value.text)
+
+	case fieldTime:
+		if value.kind != tokString {
+			return p.errorf(value, "%s needs a date or time string", f.name)
+		}
+		at, err := parseTime(value.text)
+		if err != nil {
+			return p.errorf(value, "%s needs a date (2006-01-02) or RFC 3339 time", f.name)
+		}
+		s.write(f.column+" "+sqlOp+" %s", at)
+
+	case fieldLabel:
+		if value.kind != tokString || (op != "=" && op != "!=") {
+			return p.errorf(value, "label only supports = and != with a label name")
+		}
+		if op == "!=" {
+			s.write("NOT ")
+		}
+		s.write("EXISTS (SELECT 1 FROM csv_row_labels rl JOIN csv_labels l ON l.id = rl.label_id"+
+			" WHERE rl.row_id = csv_rows.id AND l.name = %s)", value.text)
+
+	case fieldData:
+		if value.kind == tokNumber {
+			dataNumber(s, f.column)
+			s.write(" "+sqlOp+" %s::numeric", value.text)
+		} else {
+			s.write("data->>%s::text "+sqlOp+" %s", f.column, value.text)
+		}
+	}
+
+	return nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339, s); err == nil {
+		return at, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+// LikePattern escapes LIKE wildcards in s and wraps it for a substring
+// match.
+func LikePattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + s + "%"
+}
+
+// Sort compiles a sort expression to an ORDER BY list. The caller should
+// append its own tie-breaker.
+func Sort(input string) (*SQL, error) {
+	p, err := newParser(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var s SQL
+	for {
+		if s.Text != "" {
+			s.write(", ")
+		}
+
+		dir := "ASC"
+		if p.peek().kind == tokMinus {
+			p.next()
+			dir = "DESC"
+		}
+
+		start := p.peek()
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+
+		switch f.kind {
+		case fieldLabel:
+			return nil, p.errorf(start, "cannot sort by label")
+		case fieldData:
+			dataNumber(&s, f.column)
+			s.write(" "+dir+" NULLS LAST, data->>%s::text "+dir+" NULLS LAST", f.column)
+		default:
+			s.write(f.column + " " + dir)
+		}
+
+		t := p.next()
+		if t.kind == tokEOF {
+			return &s, nil
+		}
+		if t.kind != tokComma {
+			return nil, p.errorf(t, "expected , but found %s", t)
+		}
+	}
+}
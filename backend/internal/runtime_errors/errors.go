@@ -22,4 +22,39 @@ type UnauthorizedError struct{
 
 func (e *UnauthorizedError) Error() string {
 	return e.Message
-}
\ No newline at end of file
+}
+
+// ConflictError is a write against stale data. Current, when set, is the
+// up to date resource and is sent back in the response body.
+type ConflictError struct{
+	Message string
+	Current any
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+type PreconditionRequiredError struct{
+	Message string
+}
+
+func (e *PreconditionRequiredError) Error() string {
+	return e.Message
+}
+
+type ForbiddenError struct{
+	Message string
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.Message
+}
+
+type NotFoundError struct{
+	Message string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Message
+}
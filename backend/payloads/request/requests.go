@@ -1,5 +1,12 @@
 package request
 
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
 type RegisterRequest struct{
 	Email string `json:"email"`
 	Username string `json:"username"`
@@ -9,4 +16,250 @@ type RegisterRequest struct{
 type LoginRequest struct{
 	Email string `json:"email"`
 	Password string `json:"password"`
-}
\ No newline at end of file
+}
+
+// RowRequest is the body for creating or updating a row. Rank takes
+// precedence over Position. With neither, a new row is appended and an
+// updated row keeps its place. Version, when set, must match the row's
+// current version for an update to go through.
+type RowRequest struct {
+	Position  *float64 `json:"position"`
+	Rank      string   `json:"rank"`
+	InputText string   `json:"input_text"`
+	Version   *int     `json:"version"`
+}
+
+// ReorderRowsRequest moves many rows at once. Give either RowIDs or the
+// inclusive range FromID..ToID. With AfterID the rows are moved, in order, to
+// directly after that row (0 for the top of the file); without it RowIDs are
+// rearranged among the slots they already occupy.
+type ReorderRowsRequest struct {
+	RowIDs  []int `json:"row_ids"`
+	FromID  *int  `json:"from_id"`
+	ToID    *int  `json:"to_id"`
+	AfterID *int  `json:"after_id"`
+}
+
+// BatchOperation is one step of a batch. Op is "create", "update", "move" or
+// "delete". Create and update read the embedded row fields; move places
+// RowID directly after AfterID (0 for the top of the file). Version guards
+// update and delete the same way If-Match does for single rows.
+type BatchOperation struct {
+	Op      string `json:"op"`
+	RowID   int    `json:"row_id"`
+	AfterID *int   `json:"after_id"`
+	RowRequest
+}
+
+type BatchRowsRequest struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BulkInsertRowsRequest inserts Rows, in order, directly after AfterID. An
+// AfterID of 0 inserts at the top of the file; leaving it out appends.
+type BulkInsertRowsRequest struct {
+	AfterID *int      `json:"after_id"`
+	Rows    []BulkRow `json:"rows"`
+}
+
+// BulkRow decodes from either a plain string, which becomes the row text, or
+// an object of column values. An object's "input_text" key is used as the
+// row text and the whole object is stored as the row's data. Repeated
+// column names are rejected rather than left to overwrite each other.
+type BulkRow struct {
+	InputText string
+	Data      json.RawMessage
+}
+
+func (r *BulkRow) UnmarshalJSON(b []byte) error {
+	var text string
+	if err := json.Unmarshal(b, &text); err == nil {
+		r.InputText = text
+		return nil
+	}
+
+	var columns map[string]any
+	if err := json.Unmarshal(b, &columns); err != nil || columns == nil {
+		return errors.New("row must be a string or an object")
+	}
+	if err := checkUniqueKeys(b); err != nil {
+		return err
+	}
+
+	if text, ok := columns["input_text"].(string); ok {
+		r.InputText = text
+	}
+	r.Data = append(json.RawMessage(nil), b...)
+	return nil
+}
+
+// checkUniqueKeys fails when the JSON object b names a key more than once.
+func checkUniqueKeys(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if seen[key.(string)] {
+			return fmt.Errorf("column %q is given more than once", key)
+		}
+		seen[key.(string)] = true
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteRowsRequest selects rows to delete. Filters are AND-ed and at least
+// one is required. Position bounds are inclusive; Empty matches rows whose
+// text is empty or whitespace only. DryRun only counts the matches.
+type DeleteRowsRequest struct {
+	RowIDs      []int    `json:"row_ids"`
+	MinPosition *float64 `json:"min_position"`
+	MaxPosition *float64 `json:"max_position"`
+	Contains    string   `json:"contains"`
+	Empty       bool     `json:"empty"`
+	DryRun      bool     `json:"dry_run"`
+}
+
+// TrashRequest names trashed files and rows to restore or purge.
+type TrashRequest struct {
+	FileIDs []int `json:"file_ids"`
+	RowIDs  []int `json:"row_ids"`
+}
+
+// FileRequest changes a file's details. Fields left out keep their value;
+// an empty Description clears it, and Metadata, a JSON object, replaces the
+// file's metadata as a whole.
+type FileRequest struct {
+	FileName    *string         `json:"filename"`
+	Description *string         `json:"description"`
+	Metadata    json.RawMessage `json:"metadata"`
+}
+
+// LabelRequest creates or updates a file label. A status label is mutually
+// exclusive with the file's other status labels on any one row.
+type LabelRequest struct {
+	Name     string `json:"name"`
+	Color    string `json:"color"`
+	IsStatus bool   `json:"is_status"`
+}
+
+// LabelRowsRequest lists the rows to attach a label to or detach it from.
+type LabelRowsRequest struct {
+	RowIDs []int `json:"row_ids"`
+}
+
+// RowsQuery narrows a rows listing. Rows must carry every label in LabelIDs.
+// Paged listings return up to Limit rows after Cursor, and the total match
+// count when Count is set. They can also be searched for Search, as a
+// substring or, in fuzzy Mode, by trigram similarity of at least Threshold.
+// Filter and Sort are rowquery expressions. Ordinals asks paged listings
+// for each row's ordinal, which full listings always include.
+type RowsQuery struct {
+	LabelIDs  []int
+	Filter    string
+	Sort      string
+	Cursor    string
+	Limit     int
+	Count     bool
+	Search    string
+	Mode      string
+	Threshold *float64
+	Ordinals  bool
+}
+
+// TrashQuery pages the trash listing. Trashed files and rows are paged
+// separately, each up to Limit entries after its own cursor.
+type TrashQuery struct {
+	Limit       int
+	FilesCursor string
+	RowsCursor  string
+}
+
+// CommentRequest starts a thread on a row, or replies to the thread
+// containing ParentID.
+type CommentRequest struct {
+	Body     string `json:"body"`
+	ParentID *int64 `json:"parent_id"`
+}
+
+type ResolveThreadRequest struct {
+	Resolved bool `json:"resolved"`
+}
+
+// ReplaceRequest finds Pattern in one column and replaces it. Pattern is
+// literal unless Regex is set, in which case it is RE2 syntax and
+// Replacement may refer to capture groups as $1 or ${name}. Column is
+// input_text (the default) or a data column name. Rows can be narrowed the
+// same way as DeleteRowsRequest. Preview reports the changes without
+// writing them.
+type ReplaceRequest struct {
+	Pattern     string   `json:"pattern"`
+	Replacement string   `json:"replacement"`
+	Regex       bool     `json:"regex"`
+	IgnoreCase  bool     `json:"ignore_case"`
+	Column      string   `json:"column"`
+	RowIDs      []int    `json:"row_ids"`
+	MinPosition *float64 `json:"min_position"`
+	MaxPosition *float64 `json:"max_position"`
+	Preview     bool     `json:"preview"`
+}
+
+// DedupeRequest looks for rows sharing a value in Column, which is
+// input_text (the default) or a data column name. Normalize compares
+// values ignoring case and runs of whitespace. Delete trashes all but the
+// first row of each group.
+type DedupeRequest struct {
+	Column    string `json:"column"`
+	Normalize bool   `json:"normalize"`
+	Delete    bool   `json:"delete"`
+}
+
+// SearchQuery is a full-text search, optionally limited to one file.
+type SearchQuery struct {
+	Query  string
+	FileID int
+	Limit  int
+	Offset int
+}
+
+// SampleRequest draws Size random rows, or Size rows per stratum when
+// Stratify names a data column or is "label". The same Seed gives the same
+// sample. LabelIDs and Filter narrow the rows first, as in RowsQuery.
+// FileName is only used when the sample is saved as a new file.
+type SampleRequest struct {
+	Size     int    `json:"size"`
+	Seed     string `json:"seed"`
+	Stratify string `json:"stratify"`
+	LabelIDs []int  `json:"label_ids"`
+	Filter   string `json:"filter"`
+	FileName string `json:"file_name"`
+}
+
+// SplitRequest splits a file's rows into Partitions, whose ratios must add
+// up to 1. Seed, Stratify, LabelIDs and Filter work as in SampleRequest.
+// Output is "files" (the default) to save each partition as a new file, or
+// "zip" to download them as CSVs.
+type SplitRequest struct {
+	Partitions []SplitPartition `json:"partitions"`
+	Seed       string           `json:"seed"`
+	Stratify   string           `json:"stratify"`
+	LabelIDs   []int            `json:"label_ids"`
+	Filter     string           `json:"filter"`
+	Output     string           `json:"output"`
+}
+
+type SplitPartition struct {
+	Name  string  `json:"name"`
+	Ratio float64 `json:"ratio"`
+}
@@ -1,5 +1,10 @@
 package response
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type LoginResponse struct{
 	Jwt string `json:"jwt"`
 	Refresh string `json:"refresh"`
@@ -9,10 +14,254 @@ type GetFilesResponse struct {
 	ID int `json:"id"`
 	Filename string `json:"filename"`
 	UploadedAt string `json:"uploaded_at"`
+	ChangeCount int64 `json:"change_count"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Description *string `json:"description"`
+	Metadata json.RawMessage `json:"metadata"`
 }
 
 type GetRowsResponse struct{
 	Id int `json:"id"`
 	Position float64 `json:"position"`
+	Rank string `json:"rank"`
 	InputText string `json:"input_text"`
-}
\ No newline at end of file
+	Data json.RawMessage `json:"data,omitempty"`
+	Version int `json:"version"`
+	UpdatedAt string `json:"updated_at"`
+	Labels []int64 `json:"labels,omitempty"`
+	Score *float64 `json:"score,omitempty"`
+	Ordinal int64 `json:"ordinal,omitempty"`
+}
+
+type RebalanceResponse struct {
+	RowsRenumbered int64 `json:"rows_renumbered"`
+}
+
+// BatchOperationResult reports one applied batch operation. Row is the row
+// after the operation and is omitted for deletes.
+type BatchOperationResult struct {
+	Op    string           `json:"op"`
+	RowID int              `json:"row_id"`
+	Row   *GetRowsResponse `json:"row,omitempty"`
+}
+
+// DeleteRowsResponse holds the number of rows deleted, or that would be
+// deleted on a dry run.
+type DeleteRowsResponse struct {
+	Deleted int64 `json:"deleted"`
+	DryRun  bool  `json:"dry_run"`
+}
+
+type TrashedFile struct {
+	ID        int    `json:"id"`
+	Filename  string `json:"filename"`
+	DeletedAt string `json:"deleted_at"`
+}
+
+type TrashedRow struct {
+	ID        int    `json:"id"`
+	FileID    int    `json:"file_id"`
+	InputText string `json:"input_text"`
+	DeletedAt string `json:"deleted_at"`
+}
+
+// TrashResponse is one page of the trash, newest first. A next cursor is
+// set when its list has more entries.
+type TrashResponse struct {
+	Files           []TrashedFile `json:"files"`
+	Rows            []TrashedRow  `json:"rows"`
+	NextFilesCursor string        `json:"next_files_cursor,omitempty"`
+	NextRowsCursor  string        `json:"next_rows_cursor,omitempty"`
+}
+
+// TrashCountResponse holds how many files and rows a trash operation touched.
+type TrashCountResponse struct {
+	Files int64 `json:"files"`
+	Rows  int64 `json:"rows"`
+}
+
+type RowRevisionResponse struct {
+	ID            int             `json:"id"`
+	RowID         int             `json:"row_id"`
+	Action        string          `json:"action"`
+	ChangedBy     int             `json:"changed_by"`
+	ChangedByName string          `json:"changed_by_name"`
+	OldText       string          `json:"old_text"`
+	NewText       string          `json:"new_text"`
+	OldPosition   float64         `json:"old_position"`
+	NewPosition   float64         `json:"new_position"`
+	OldData       json.RawMessage `json:"old_data,omitempty"`
+	NewData       json.RawMessage `json:"new_data,omitempty"`
+	ChangedAt     string          `json:"changed_at"`
+}
+
+// UndoResponse describes the operation an undo or redo replayed.
+type UndoResponse struct {
+	OperationID int64  `json:"operation_id"`
+	Kind        string `json:"kind"`
+	RowsChanged int64  `json:"rows_changed"`
+}
+
+type LabelResponse struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Color    string `json:"color"`
+	IsStatus bool   `json:"is_status"`
+	RowCount int64  `json:"row_count"`
+}
+
+type LabelRowsResponse struct {
+	RowsChanged int64 `json:"rows_changed"`
+}
+
+// CommentResponse is a comment. Listings return each thread's first comment
+// with the rest of the thread in Replies.
+type CommentResponse struct {
+	ID         int64             `json:"id"`
+	RowID      int64             `json:"row_id"`
+	ParentID   *int64            `json:"parent_id,omitempty"`
+	AuthorID   int               `json:"author_id"`
+	AuthorName string            `json:"author_name"`
+	Body       string            `json:"body"`
+	Resolved   bool              `json:"resolved"`
+	ResolvedBy *int              `json:"resolved_by,omitempty"`
+	ResolvedAt *string           `json:"resolved_at,omitempty"`
+	CreatedAt  string            `json:"created_at"`
+	UpdatedAt  string            `json:"updated_at"`
+	Replies    []CommentResponse `json:"replies,omitempty"`
+}
+
+type ReplaceResponse struct {
+	Preview      bool               `json:"preview"`
+	RowsChanged  int                `json:"rows_changed"`
+	Replacements int                `json:"replacements"`
+	Rows         []ReplaceRowResult `json:"rows"`
+}
+
+// ReplaceRowResult is one row's column text before and after replacing.
+// Version is the row's new version and is only set once applied.
+type ReplaceRowResult struct {
+	RowID   int    `json:"row_id"`
+	Before  string `json:"before"`
+	After   string `json:"after"`
+	Matches int    `json:"matches"`
+	Version int    `json:"version,omitempty"`
+}
+
+// DedupeResponse lists duplicate groups in file order. Duplicates counts the
+// rows beyond the first of each group; Deleted is how many were trashed.
+type DedupeResponse struct {
+	Groups     []DuplicateGroup `json:"groups"`
+	Duplicates int64            `json:"duplicates"`
+	Deleted    int64            `json:"deleted"`
+}
+
+// DuplicateGroup is a compared value and its rows in file order. The first
+// row is the one kept.
+type DuplicateGroup struct {
+	Value  string  `json:"value"`
+	RowIDs []int64 `json:"row_ids"`
+}
+
+// RowsPageResponse is one page of rows. NextCursor is set when HasMore is,
+// and Total only when a count was asked for.
+type RowsPageResponse struct {
+	Rows       []GetRowsResponse `json:"rows"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	HasMore    bool              `json:"has_more"`
+	Total      *int64            `json:"total,omitempty"`
+}
+
+// SearchResult is a matching row. Snippet is HTML-escaped row text with the
+// matched words wrapped in <mark> tags; a higher Rank is a better match.
+type SearchResult struct {
+	FileID   int     `json:"file_id"`
+	FileName string  `json:"file_name"`
+	RowID    int     `json:"row_id"`
+	Position float64 `json:"position"`
+	Snippet  string  `json:"snippet"`
+	Rank     float64 `json:"rank"`
+}
+
+// FileStatsResponse is a data-quality report over a file's live rows.
+// Cached is set when the report was served from the cache.
+type FileStatsResponse struct {
+	RowCount        int64         `json:"row_count"`
+	EmptyRows       int64         `json:"empty_rows"`
+	DuplicateRows   int64         `json:"duplicate_rows"`
+	DuplicateGroups int64         `json:"duplicate_groups"`
+	Length          LengthStats   `json:"length"`
+	TopTokens       []TokenCount  `json:"top_tokens"`
+	InvalidUTF8Rows int64         `json:"invalid_utf8_rows"`
+	ControlCharRows int64         `json:"control_char_rows"`
+	Columns         []ColumnStats `json:"columns"`
+	ComputedAt      string        `json:"computed_at"`
+	Cached          bool          `json:"cached"`
+}
+
+// LengthStats describes input_text lengths in characters.
+type LengthStats struct {
+	Min       int            `json:"min"`
+	Max       int            `json:"max"`
+	Mean      float64        `json:"mean"`
+	Median    float64        `json:"median"`
+	P90       float64        `json:"p90"`
+	P99       float64        `json:"p99"`
+	Histogram []LengthBucket `json:"histogram"`
+}
+
+// LengthBucket counts the rows with a text length in [From, To].
+type LengthBucket struct {
+	From int   `json:"from"`
+	To   int   `json:"to"`
+	Rows int64 `json:"rows"`
+}
+
+type TokenCount struct {
+	Token string `json:"token"`
+	Count int64  `json:"count"`
+}
+
+// ColumnStats describes one data column. NullRate is the share of rows
+// where the column is missing, null or empty.
+type ColumnStats struct {
+	Name     string  `json:"name"`
+	NonEmpty int64   `json:"non_empty"`
+	NullRate float64 `json:"null_rate"`
+	Distinct int64   `json:"distinct"`
+}
+
+// SampleResponse holds a sample grouped by stratum, with the seed that
+// reproduces it. FileID is set when the sample was saved as a new file.
+type SampleResponse struct {
+	Seed   string        `json:"seed"`
+	Groups []SampleGroup `json:"groups"`
+	FileID *int64        `json:"file_id,omitempty"`
+}
+
+// SampleGroup is one stratum of a sample in file order. Stratum is null
+// when the sample is not stratified.
+type SampleGroup struct {
+	Stratum *string           `json:"stratum"`
+	Rows    []GetRowsResponse `json:"rows"`
+}
+
+// SplitResponse is a recorded split. Params is the request that made it,
+// seed included, and can be sent again to redo the split.
+type SplitResponse struct {
+	ID           int64            `json:"id"`
+	SourceFileID int              `json:"source_file_id"`
+	Seed         string           `json:"seed"`
+	Params       json.RawMessage  `json:"params"`
+	Partitions   []SplitPartition `json:"partitions"`
+	CreatedAt    string           `json:"created_at"`
+}
+
+// SplitPartition is one partition of a split. FileID is the file it was
+// saved as, when it was.
+type SplitPartition struct {
+	Name   string  `json:"name"`
+	Ratio  float64 `json:"ratio"`
+	Rows   int     `json:"rows"`
+	FileID *int64  `json:"file_id,omitempty"`
+}
@@ -0,0 +1,120 @@
+package core_service
+
+import (
+	"backend/internal/runtime_errors"
+	"backend/payloads/request"
+	"backend/payloads/response"
+	"database/sql"
+	"fmt"
+)
+
+// maxBatchOperations bounds how much work one batch request can hold a file
+// lock for.
+const maxBatchOperations = 1000
+
+// BatchRowsService applies operations in order inside a single transaction.
+// The first failing operation rolls back the whole batch and its error says
+// which operation it was.
+func BatchRowsService(userID, fileID int, batch request.BatchRowsRequest) ([]response.BatchOperationResult, error) {
+	if len(batch.Operations) == 0 {
+		return nil, &runtime_errors.BadRequestError{Message: "No operations given"}
+	}
+	if len(batch.Operations) > maxBatchOperations {
+		return nil, &runtime_errors.BadRequestError{
+			Message: fmt.Sprintf("At most %d operations per batch", maxBatchOperations),
+		}
+	}
+
+	results := make([]response.BatchOperationResult, 0, len(batch.Operations))
+	err := withTx(func(tx *sql.Tx) error {
+		if err := beginOperation(tx, userID, fileID, "batch"); err != nil {
+			return err
+		}
+
+		for i, op := range batch.Operations {
+			result, err := applyBatchOperation(tx, userID, fileID, op)
+			if err != nil {
+				return annotateError(err, fmt.Sprintf("operation %d (%s): ", i, op.Op))
+			}
+			results = append(results, result)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func applyBatchOperation(tx *sql.Tx, userID, fileID int, op request.BatchOperation) (response.BatchOperationResult, error) {
+	result := response.BatchOperationResult{Op: op.Op, RowID: op.RowID}
+
+	switch op.Op {
+	case "create":
+		if op.InputText == "" {
+			return result, &runtime_errors.BadRequestError{Message: "Input text cannot be empty"}
+		}
+		row, err := createRow(tx, fileID, op.RowRequest)
+		if err != nil {
+			return result, err
+		}
+		result.RowID = row.Id
+		result.Row = row
+
+	case "update":
+		if op.InputText == "" {
+			return result, &runtime_errors.BadRequestError{Message: "Input text cannot be empty"}
+		}
+		row, err := updateRow(tx, userID, fileID, op.RowID, op.RowRequest)
+		if err != nil {
+			return result, err
+		}
+		result.Row = row
+
+	case "move":
+		if op.AfterID == nil {
+			return result, &runtime_errors.BadRequestError{Message: "after_id is required"}
+		}
+		ids := []int64{int64(op.RowID)}
+		if err := checkRowsInFile(tx, fileID, ids); err != nil {
+			return result, err
+		}
+		if err := moveRowsAfter(tx, userID, fileID, ids, *op.AfterID); err != nil {
+			return result, err
+		}
+		rows, err := rowsByIDs(tx, ids)
+		if err != nil {
+			return result, err
+		}
+		result.Row = &rows[0]
+
+	case "delete":
+		if err := deleteRow(tx, fileID, op.RowID, op.Version); err != nil {
+			return result, err
+		}
+
+	default:
+		return result, &runtime_errors.BadRequestError{Message: fmt.Sprintf("Unknown op %q", op.Op)}
+	}
+
+	return result, nil
+}
+
+// annotateError prefixes the message of a runtime error without changing its
+// type, so the HTTP status stays the same.
+func annotateError(err error, prefix string) error {
+	switch e := err.(type) {
+	case *runtime_errors.BadRequestError:
+		return &runtime_errors.BadRequestError{Message: prefix + e.Message}
+	case *runtime_errors.UnauthorizedError:
+		return &runtime_errors.UnauthorizedError{Message: prefix + e.Message}
+	case *runtime_errors.InternalServerError:
+		return &runtime_errors.InternalServerError{Message: prefix + e.Message}
+	case *runtime_errors.ConflictError:
+		return &runtime_errors.ConflictError{Message: prefix + e.Message, Current: e.Current}
+	default:
+		return err
+	}
+}
@@ -0,0 +1,114 @@
+package core_service
+
+import (
+	"backend/internal/runtime_errors"
+	"backend/payloads/request"
+	"backend/payloads/response"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// maxBulkInsertRows bounds a single bulk insert.
+const maxBulkInsertRows = 10000
+
+// BulkInsertRowsService inserts rows, in order, directly after AfterID (0 for
+// the top of the file, nil for the end) in one transaction. Positions and
+// ranks are spread evenly across the gap.
+func BulkInsertRowsService(userID, fileID int, bulk request.BulkInsertRowsRequest) ([]response.GetRowsResponse, error) {
+	if len(bulk.Rows) == 0 {
+		return nil, &runtime_errors.BadRequestError{Message: "No rows given"}
+	}
+	if len(bulk.Rows) > maxBulkInsertRows {
+		return nil, &runtime_errors.BadRequestError{
+			Message: fmt.Sprintf("At most %d rows per request", maxBulkInsertRows),
+		}
+	}
+
+	for i, row := range bulk.Rows {
+		if row.InputText == "" {
+			return nil, &runtime_errors.BadRequestError{
+				Message: fmt.Sprintf("Row %d: input text cannot be empty", i+1),
+			}
+		}
+	}
+
+	var inserted []response.GetRowsResponse
+	err := withTx(func(tx *sql.Tx) error {
+		if err := beginOperation(tx, userID, fileID, "bulk_insert"); err != nil {
+			return err
+		}
+
+		var err error
+		inserted, err = bulkInsertRows(tx, fileID, bulk)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return inserted, nil
+}
+
+func bulkInsertRows(tx *sql.Tx, fileID int, bulk request.BulkInsertRowsRequest) ([]response.GetRowsResponse, error) {
+	afterID := 0
+	if bulk.AfterID != nil {
+		afterID = *bulk.AfterID
+	} else {
+		err := tx.QueryRow(`
+			SELECT COALESCE(
+				(SELECT id FROM csv_rows WHERE csv_file_id = $1 AND deleted_at IS NULL
+				 ORDER BY rank DESC, id DESC LIMIT 1), 0)`,
+			fileID,
+		).Scan(&afterID)
+		if err != nil {
+			return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+	}
+
+	positions, ranks, rebalance, err := slotsAfter(tx, fileID, afterID, nil, len(bulk.Rows))
+	if err != nil {
+		return nil, err
+	}
+
+	texts := make([]string, len(bulk.Rows))
+	data := make([]string, len(bulk.Rows))
+	for i, row := range bulk.Rows {
+		texts[i] = row.InputText
+		data[i] = string(row.Data)
+	}
+
+	rows, err := tx.Query(`
+		INSERT INTO csv_rows (csv_file_id, position, rank, input_text, data, created_at)
+		SELECT $1, v.position, v.rank, v.input_text, NULLIF(v.data, '')::jsonb, NOW()
+		FROM unnest($2::numeric[], $3::text[], $4::text[], $5::text[])
+			AS v(position, rank, input_text, data)
+		RETURNING id`,
+		fileID, pq.Array(positions), pq.Array(ranks), pq.Array(texts), pq.Array(data),
+	)
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0, len(bulk.Rows))
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	if rebalance {
+		if _, err := rebalanceFile(tx, fileID, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return rowsByIDs(tx, ids)
+}
@@ -0,0 +1,303 @@
+package core_service
+
+import (
+	"backend/internal/db"
+	"backend/internal/runtime_errors"
+	"backend/payloads/request"
+	"backend/payloads/response"
+	"database/sql"
+	"strings"
+)
+
+// commentColumns is the column list scanComment expects. Queries alias
+// csv_row_comments as c and user_table as u.
+const commentColumns = `c.id, c.row_id, c.parent_id, c.author_id, COALESCE(u.username, ''), c.body,
+	c.resolved_at IS NOT NULL, c.resolved_by, c.resolved_at,
+	c.created_at, c.updated_at`
+
+func scanComment(s rowScanner, comment *response.CommentResponse) error {
+	var parentID, authorID, resolvedBy sql.NullInt64
+	var resolvedAt sql.NullString
+	err := s.Scan(&comment.ID, &comment.RowID, &parentID, &authorID, &comment.AuthorName, &comment.Body,
+		&comment.Resolved, &resolvedBy, &resolvedAt, &comment.CreatedAt, &comment.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	if parentID.Valid {
+		comment.ParentID = &parentID.Int64
+	}
+	comment.AuthorID = int(authorID.Int64)
+	if resolvedBy.Valid {
+		id := int(resolvedBy.Int64)
+		comment.ResolvedBy = &id
+	}
+	if resolvedAt.Valid {
+		comment.ResolvedAt = &resolvedAt.String
+	}
+	return nil
+}
+
+// GetRowCommentsService lists every thread on a row, resolved or not,
+// oldest first.
+func GetRowCommentsService(userID, fileID, rowID int) ([]response.CommentResponse, error) {
+	var where whereClause
+	where.add("r.id = %s", rowID)
+	return listThreads(userID, fileID, where)
+}
+
+// GetFileThreadsService lists the threads on a file's live rows in row
+// order. Resolved threads are left out unless includeResolved is set.
+func GetFileThreadsService(userID, fileID int, includeResolved bool) ([]response.CommentResponse, error) {
+	var where whereClause
+	if !includeResolved {
+		where.add("t.resolved_at IS NULL")
+	}
+	return listThreads(userID, fileID, where)
+}
+
+// listThreads loads the threads matching where, which may refer to the
+// thread's first comment as t and its row as r, with their replies nested.
+func listThreads(userID, fileID int, where whereClause) ([]response.CommentResponse, error) {
+	if err := checkOwnedFile(db.DB, fileID, userID); err != nil {
+		return nil, err
+	}
+
+	where.add("r.csv_file_id = %s", fileID)
+	where.add("r.deleted_at IS NULL")
+	where.add("f.uploaded_by = %s", userID)
+	where.add("f.deleted_at IS NULL")
+
+	rows, err := db.DB.Query(`
+		SELECT `+commentColumns+`
+		FROM csv_row_comments c
+		JOIN csv_row_comments t ON t.id = COALESCE(c.parent_id, c.id)
+		JOIN csv_rows r ON r.id = c.row_id
+		JOIN csv_table f ON f.id = r.csv_file_id
+		LEFT JOIN user_table u ON u.id = c.author_id
+		WHERE `+where.String()+`
+		ORDER BY r.rank, r.id, t.id, c.id`,
+		where.args...,
+	)
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	defer rows.Close()
+
+	// A thread's first comment always sorts ahead of its replies.
+	threads := []response.CommentResponse{}
+	for rows.Next() {
+		var comment response.CommentResponse
+		if err := scanComment(rows, &comment); err != nil {
+			return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		if comment.ParentID == nil {
+			comment.Replies = []response.CommentResponse{}
+			threads = append(threads, comment)
+			continue
+		}
+		thread := &threads[len(threads)-1]
+		thread.Replies = append(thread.Replies, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return threads, nil
+}
+
+// CreateCommentService starts a thread on a row, or replies to one when
+// ParentID is set. Replies always attach to the thread's first comment.
+func CreateCommentService(userID, fileID, rowID int, comment request.CommentRequest) (*response.CommentResponse, error) {
+	comment.Body = strings.TrimSpace(comment.Body)
+	if comment.Body == "" {
+		return nil, &runtime_errors.BadRequestError{Message: "Comment cannot be empty"}
+	}
+
+	var created response.CommentResponse
+	err := withTx(func(tx *sql.Tx) error {
+		if err := lockOwnedFile(tx, fileID, userID); err != nil {
+			return err
+		}
+
+		var live bool
+		err := tx.QueryRow(`
+			SELECT deleted_at IS NULL FROM csv_rows
+			WHERE id = $1 AND csv_file_id = $2`,
+			rowID, fileID,
+		).Scan(&live)
+		if err == sql.ErrNoRows || (err == nil && !live) {
+			return &runtime_errors.BadRequestError{Message: "Row not found"}
+		}
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		if comment.ParentID != nil {
+			parent, err := lockComment(tx, fileID, *comment.ParentID)
+			if err != nil {
+				return err
+			}
+			if parent.RowID != int64(rowID) {
+				return &runtime_errors.BadRequestError{Message: "Parent comment is on another row"}
+			}
+			if parent.ParentID != nil {
+				comment.ParentID = parent.ParentID
+			}
+		}
+
+		var id int64
+		err = tx.QueryRow(`
+			INSERT INTO csv_row_comments (row_id, parent_id, author_id, body)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id`,
+			rowID, comment.ParentID, userID, comment.Body,
+		).Scan(&id)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		return readComment(tx, id, &created)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// UpdateCommentService edits a comment's text. Files are not shared, so the
+// file's owner is the author of every comment on it and needs no separate
+// author check.
+func UpdateCommentService(userID, fileID int, commentID int64, body string) (*response.CommentResponse, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, &runtime_errors.BadRequestError{Message: "Comment cannot be empty"}
+	}
+
+	var updated response.CommentResponse
+	err := withTx(func(tx *sql.Tx) error {
+		if err := lockOwnedFile(tx, fileID, userID); err != nil {
+			return err
+		}
+
+		if _, err := lockComment(tx, fileID, commentID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(`
+			UPDATE csv_row_comments SET body = $1, updated_at = now()
+			WHERE id = $2`,
+			body, commentID)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		return readComment(tx, commentID, &updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// DeleteCommentService deletes a comment. Deleting a thread's first comment
+// deletes the whole thread. As with edits, owning the file is enough.
+func DeleteCommentService(userID, fileID int, commentID int64) error {
+	return withTx(func(tx *sql.Tx) error {
+		if err := lockOwnedFile(tx, fileID, userID); err != nil {
+			return err
+		}
+
+		if _, err := lockComment(tx, fileID, commentID); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`DELETE FROM csv_row_comments WHERE id = $1`, commentID); err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		return nil
+	})
+}
+
+// ResolveThreadService marks a thread resolved or reopens it. commentID
+// may be any comment in the thread.
+func ResolveThreadService(userID, fileID int, commentID int64, resolved bool) (*response.CommentResponse, error) {
+	var thread response.CommentResponse
+	err := withTx(func(tx *sql.Tx) error {
+		if err := lockOwnedFile(tx, fileID, userID); err != nil {
+			return err
+		}
+
+		current, err := lockComment(tx, fileID, commentID)
+		if err != nil {
+			return err
+		}
+		threadID := commentID
+		if current.ParentID != nil {
+			threadID = *current.ParentID
+		}
+
+		if resolved {
+			_, err = tx.Exec(`
+				UPDATE csv_row_comments SET resolved_at = now(), resolved_by = $1
+				WHERE id = $2 AND resolved_at IS NULL`,
+				userID, threadID)
+		} else {
+			_, err = tx.Exec(`
+				UPDATE csv_row_comments SET resolved_at = NULL, resolved_by = NULL
+				WHERE id = $1`,
+				threadID)
+		}
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		return readComment(tx, threadID, &thread)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &thread, nil
+}
+
+// lockComment locks a comment on one of the file's rows and returns it.
+// Comments on trashed rows are treated as missing.
+func lockComment(tx *sql.Tx, fileID int, commentID int64) (*response.CommentResponse, error) {
+	var comment response.CommentResponse
+	err := scanComment(tx.QueryRow(`
+		SELECT `+commentColumns+`
+		FROM csv_row_comments c
+		JOIN csv_rows r ON r.id = c.row_id
+		LEFT JOIN user_table u ON u.id = c.author_id
+		WHERE c.id = $1 AND r.csv_file_id = $2 AND r.deleted_at IS NULL
+		FOR UPDATE OF c`,
+		commentID, fileID,
+	), &comment)
+	if err == sql.ErrNoRows {
+		return nil, &runtime_errors.BadRequestError{Message: "Comment not found"}
+	}
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return &comment, nil
+}
+
+func readComment(tx *sql.Tx, commentID int64, comment *response.CommentResponse) error {
+	err := scanComment(tx.QueryRow(`
+		SELECT `+commentColumns+`
+		FROM csv_row_comments c
+		LEFT JOIN user_table u ON u.id = c.author_id
+		WHERE c.id = $1`,
+		commentID,
+	), comment)
+	if err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return nil
+}
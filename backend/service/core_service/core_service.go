@@ -2,106 +2,163 @@ package core_service
 
 import (
 	"backend/internal/db"
+	"backend/internal/lexorank"
 	"backend/internal/runtime_errors"
+	"backend/payloads/request"
 	"backend/payloads/response"
+	"context"
+	"database/sql"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
+	"strings"
+
+	"github.com/lib/pq"
 )
 
 
 func UploadCsvService(file multipart.File, filename string, uploadedBy int) error {
 	reader := csv.NewReader(file)
 
-	// Insert into csv_table
-	var fileID int64
-	err := db.DB.QueryRow(`
-		INSERT INTO csv_table (file_name, uploaded_by) 
-		VALUES ($1, $2) 
-		RETURNING id
-	`, filename, uploadedBy).Scan(&fileID)
+	// The header row names the columns kept in data. It is checked before
+	// anything is written, so a rejected upload leaves no file behind.
+	header, err := reader.Read()
 	if err != nil {
-		return &runtime_errors.InternalServerError{
-			Message: fmt.Sprintf("failed to insert file record: %v", err),
+		return &runtime_errors.BadRequestError{
+			Message: fmt.Sprintf("error reading CSV header: %v", err),
 		}
 	}
-
-	// Start transaction
-	tx, err := db.DB.Begin()
+	columns, err := columnNames(validUTF8(header))
 	if err != nil {
-		return &runtime_errors.InternalServerError{
-			Message: fmt.Sprintf("failed to begin transaction: %v", err),
-		}
+		return err
 	}
-	defer func() {
+
+	var fileID int64
+	rowCount := 0
+	err = withTx(func(tx *sql.Tx) error {
+		// Insert into csv_table
+		err := tx.QueryRow(`
+			INSERT INTO csv_table (file_name, uploaded_by, column_names)
+			VALUES ($1, $2, $3)
+			RETURNING id
+		`, filename, uploadedBy, pq.Array(columns)).Scan(&fileID)
 		if err != nil {
-			tx.Rollback()
-		} else {
-			tx.Commit()
+			return &runtime_errors.InternalServerError{
+				Message: fmt.Sprintf("failed to insert file record: %v", err),
+			}
 		}
-	}()
 
-	stmt, err := tx.Prepare(`
-		INSERT INTO csv_rows (csv_file_id, position, input_text) 
-		VALUES ($1, $2, $3)
-	`)
-	if err != nil {
-		return &runtime_errors.InternalServerError{
-			Message: fmt.Sprintf("failed to prepare statement: %v", err),
+		stmt, err := tx.Prepare(`
+			INSERT INTO csv_rows (csv_file_id, position, rank, input_text, data)
+			VALUES ($1, $2, $3, $4, $5)
+		`)
+		if err != nil {
+			return &runtime_errors.InternalServerError{
+				Message: fmt.Sprintf("failed to prepare statement: %v", err),
+			}
 		}
-	}
-	defer stmt.Close()
+		defer stmt.Close()
 
-	// Skip the header row
-	_, err = reader.Read()
-	if err != nil {
-		return &runtime_errors.BadRequestError{
-			Message: fmt.Sprintf("error reading CSV header: %v", err),
-		}
-	}
+		pos := positionStep
+		step := positionStep
 
-	pos := 10.0
-	step := 10.0
-	rowCount := 0
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return &runtime_errors.BadRequestError{
+					Message: fmt.Sprintf("invalid CSV: %v", err),
+				}
+			}
+			record = validUTF8(record)
 
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return &runtime_errors.BadRequestError{
-				Message: fmt.Sprintf("invalid CSV: %v", err),
+			inputText := ""
+			if len(record) > 2 { // ensure at least 3 columns
+				inputText = record[2] // take the third column for input_text
 			}
-		}
 
-		inputText := ""
-		if len(record) > 2 { // ensure at least 3 columns
-			inputText = record[2] // take the third column for input_text
-		}
+			data, err := rowData(columns, record)
+			if err != nil {
+				return &runtime_errors.InternalServerError{
+					Message: fmt.Sprintf("failed to encode row: %v", err),
+				}
+			}
 
-		_, err = stmt.Exec(fileID, pos, inputText)
-		if err != nil {
-			return &runtime_errors.InternalServerError{
-				Message: fmt.Sprintf("failed to insert row: %v", err),
+			_, err = stmt.Exec(fileID, pos, lexorank.Ordinal(rowCount+1), inputText, string(data))
+			if err != nil {
+				return &runtime_errors.InternalServerError{
+					Message: fmt.Sprintf("failed to insert row: %v", err),
+				}
 			}
+
+			pos += step
+			rowCount++
 		}
 
-		pos += step
-		rowCount++
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	fmt.Printf("Uploaded %d rows for file %d\n", rowCount, fileID)
 	return nil
 }
 
+// columnNames names the columns kept in data after the CSV header. Columns
+// with an empty header are named column_<n>. A name used twice would have
+// one column overwrite the other, so it is rejected.
+func columnNames(header []string) ([]string, error) {
+	names := make([]string, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		if seen[name] {
+			return nil, &runtime_errors.BadRequestError{
+				Message: fmt.Sprintf("invalid CSV: column %q appears more than once in the header", name),
+			}
+		}
+		seen[name] = true
+		names[i] = name
+	}
+
+	return names, nil
+}
+
+// validUTF8 replaces bytes that are not UTF-8 with U+FFFD. Postgres rejects
+// invalid UTF-8 in text, so this lets an upload in another encoding through
+// with its bad bytes marked instead of failing the insert.
+func validUTF8(fields []string) []string {
+	for i, field := range fields {
+		fields[i] = strings.ToValidUTF8(field, "\uFFFD")
+	}
+
+	return fields
+}
+
+// rowData maps a CSV record onto the column names as a JSON object. The
+// reader holds every record to the header's width, so each value has a name.
+func rowData(columns, record []string) ([]byte, error) {
+	values := make(map[string]string, len(record))
+	for i, value := range record {
+		values[columns[i]] = value
+	}
+
+	return json.Marshal(values)
+}
+
 func GetUploadedFilesService(uploadedBy int) ([]response.GetFilesResponse,error){
 	var err error
 	var responseList []response.GetFilesResponse 
 
 
-	queryStr := "SELECT id,file_name,uploaded_at FROM csv_table WHERE uploaded_by = $1 "
+	queryStr := "SELECT "+fileColumns+" FROM csv_table WHERE uploaded_by = $1 AND deleted_at IS NULL ORDER BY id"
 
 	resultSet,err := db.DB.Query(queryStr,uploadedBy)
 
@@ -111,9 +168,11 @@ func GetUploadedFilesService(uploadedBy int) ([]response.GetFilesResponse,error)
 		}
 	}
 
+	defer resultSet.Close()
+
 	for resultSet.Next() {
 		var responseVar response.GetFilesResponse
-		err = resultSet.Scan(&responseVar.ID,&responseVar.Filename,&responseVar.UploadedAt)
+		err = scanFile(resultSet,&responseVar)
 		if err!=nil {
 			return nil,&runtime_errors.InternalServerError{
 				Message: err.Error(),
@@ -128,63 +187,72 @@ func GetUploadedFilesService(uploadedBy int) ([]response.GetFilesResponse,error)
 
 }
 
-func GetRows(userId int,fileId int)([]response.GetRowsResponse,error){
+func GetRows(userId int,fileId int,query request.RowsQuery)([]response.GetRowsResponse,error){
 	var err error
 	var responseList []response.GetRowsResponse
 
-	//need to check authenticated user specific files
-
-	queryStr := "SELECT id,position,input_text FROM csv_rows WHERE csv_file_id = $1 "
-
-	resultSet,err := db.DB.Query(queryStr,fileId)
+	resultSet,err := queryRows(context.Background(),userId,fileId,query)
 
 	if err!=nil{
-		return nil,&runtime_errors.InternalServerError{
-			Message: err.Error(),
-		}
+		return nil,err
 	}
+	defer resultSet.Close()
 
 	for resultSet.Next() {
 		var responseVar response.GetRowsResponse
-		err = resultSet.Scan(&responseVar.Id,&responseVar.Position,&responseVar.InputText)
+		var ordinal sql.NullInt64
+		err = scanRow(resultSet,&responseVar,pq.Array(&responseVar.Labels),&ordinal)
 		if err!=nil {
 			return nil,&runtime_errors.InternalServerError{
 				Message: err.Error(),
 			};
 		}
+		responseVar.Ordinal = ordinal.Int64
 
 		responseList = append(responseList, responseVar)
 	}
 
+	if err = resultSet.Err(); err!=nil {
+		return nil,&runtime_errors.InternalServerError{
+			Message: err.Error(),
+		}
+	}
 
 	return responseList,nil
 }
 
-func CreateRowService(userID, fileID int, position float64, inputText string) (*response.GetRowsResponse, error) {
-	var fileExists bool
-	err := db.DB.QueryRow(`
-		SELECT EXISTS(
-			SELECT 1 FROM csv_table WHERE id = $1 AND uploaded_by = $2
-		)`, fileID, userID).Scan(&fileExists)
-	if err != nil {
-		return nil, &runtime_errors.InternalServerError{
-			Message: err.Error(),
+func CreateRowService(userID, fileID int, row request.RowRequest) (*response.GetRowsResponse, error) {
+	var newRow *response.GetRowsResponse
+	err := withTx(func(tx *sql.Tx) error {
+		if err := beginOperation(tx, userID, fileID, "create_row"); err != nil {
+			return err
 		}
+
+		var err error
+		newRow, err = createRow(tx, fileID, row)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	if !fileExists {
-		return nil, &runtime_errors.BadRequestError{
-			Message: "File not found or access denied",
-		}
+
+	return newRow, nil
+}
+
+func createRow(tx *sql.Tx, fileID int, row request.RowRequest) (*response.GetRowsResponse, error) {
+	position, rank, err := placeRow(tx, fileID, 0, row.Position, row.Rank)
+	if err != nil {
+		return nil, err
 	}
 
 	var newRow response.GetRowsResponse
-	err = db.DB.QueryRow(`
-		INSERT INTO csv_rows (csv_file_id, position, input_text, created_at)
-		VALUES ($1, $2, $3, NOW())
-		RETURNING id, position, input_text`,
-		fileID, position, inputText,
-	).Scan(&newRow.Id, &newRow.Position, &newRow.InputText)
-	if err != nil {
+	insert := tx.QueryRow(`
+		INSERT INTO csv_rows (csv_file_id, position, rank, input_text, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING `+rowColumns,
+		fileID, position, rank, row.InputText,
+	)
+	if err = scanRow(insert, &newRow); err != nil {
 		return nil, &runtime_errors.InternalServerError{
 			Message: err.Error(),
 		}
@@ -193,125 +261,121 @@ func CreateRowService(userID, fileID int, position float64, inputText string) (*
 	return &newRow, nil
 }
 
-func UpdateRowService(userID, fileID, rowID int, position float64, inputText string) (*response.GetRowsResponse, error) {
-	var rowExists bool
-	err := db.DB.QueryRow(`
-		SELECT EXISTS(
-			SELECT 1 FROM csv_rows r
-			JOIN csv_table f ON r.csv_file_id = f.id
-			WHERE r.id = $1 AND r.csv_file_id = $2 AND f.uploaded_by = $3
-		)`, rowID, fileID, userID).Scan(&rowExists)
+func UpdateRowService(userID, fileID, rowID int, row request.RowRequest) (*response.GetRowsResponse, error) {
+	var updatedRow *response.GetRowsResponse
+	err := withTx(func(tx *sql.Tx) error {
+		if err := beginOperation(tx, userID, fileID, "update_row"); err != nil {
+			return err
+		}
+
+		var err error
+		updatedRow, err = updateRow(tx, userID, fileID, rowID, row)
+		return err
+	})
 	if err != nil {
-		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		return nil, err
+	}
+
+	return updatedRow, nil
+}
+
+// updateRow overwrites a row's text and optionally moves it, recording the
+// change as a revision by userID.
+func updateRow(tx *sql.Tx, userID, fileID, rowID int, row request.RowRequest) (*response.GetRowsResponse, error) {
+	before, err := lockRow(tx, fileID, rowID)
+	if err != nil {
+		return nil, err
 	}
-	if !rowExists {
-		return nil, &runtime_errors.BadRequestError{Message: "Row doesnt exist"}
+	if err = checkVersion(before, row.Version); err != nil {
+		return nil, err
+	}
+	position, rank := before.Position, before.Rank
+
+	// Without a position or rank the row keeps its place.
+	if row.Position != nil || row.Rank != "" {
+		position, rank, err = placeRow(tx, fileID, rowID, row.Position, row.Rank)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	var updatedRow response.GetRowsResponse
-	err = db.DB.QueryRow(`
+	update := tx.QueryRow(`
 		UPDATE csv_rows
-		SET position = $1, input_text = $2
-		WHERE id = $3 AND csv_file_id = $4
-		RETURNING id, position, input_text`,
-		position, inputText, rowID, fileID,
-	).Scan(&updatedRow.Id, &updatedRow.Position, &updatedRow.InputText)
-	if err != nil {
+		SET position = $1, rank = $2, input_text = $3
+		WHERE id = $4 AND csv_file_id = $5
+		RETURNING `+rowColumns,
+		position, rank, row.InputText, rowID, fileID,
+	)
+	if err = scanRow(update, &updatedRow); err != nil {
 		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
 	}
 
+	if err = recordRevision(tx, userID, fileID, revisionUpdate, before, &updatedRow); err != nil {
+		return nil, err
+	}
+
 	return &updatedRow, nil
 }
 
-func DeleteRowService(userID, fileID, rowID int) error {
-	result, err := db.DB.Exec(`
-		DELETE FROM csv_rows
-		WHERE id = $1 AND csv_file_id = $2 AND EXISTS(
-			SELECT 1 FROM csv_table WHERE id = $2 AND uploaded_by = $3
-		)`, rowID, fileID, userID)
+// lockRow reads a live row of the file and locks it for the rest of the
+// transaction.
+func lockRow(tx *sql.Tx, fileID, rowID int) (*response.GetRowsResponse, error) {
+	var row response.GetRowsResponse
+	err := scanRow(tx.QueryRow(`
+		SELECT `+rowColumns+` FROM csv_rows
+		WHERE id = $1 AND csv_file_id = $2 AND deleted_at IS NULL
+		FOR UPDATE`,
+		rowID, fileID,
+	), &row)
+	if err == sql.ErrNoRows {
+		return nil, &runtime_errors.NotFoundError{Message: "Row not found"}
+	}
 	if err != nil {
-		return &runtime_errors.InternalServerError{Message: err.Error()}
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return &row, nil
+}
+
+func DeleteRowService(userID, fileID, rowID int, version *int) error {
+	return withTx(func(tx *sql.Tx) error {
+		if err := beginOperation(tx, userID, fileID, "delete_row"); err != nil {
+			return err
+		}
+
+		return deleteRow(tx, fileID, rowID, version)
+	})
+}
+
+// deleteRow moves a row to the trash. A non-nil version must match the
+// row's current version.
+func deleteRow(tx *sql.Tx, fileID, rowID int, version *int) error {
+	row, err := lockRow(tx, fileID, rowID)
 	if err != nil {
-		return &runtime_errors.InternalServerError{Message: err.Error()}
+		return err
+	}
+	if err = checkVersion(row, version); err != nil {
+		return err
 	}
-	if rowsAffected == 0 {
-		return &runtime_errors.BadRequestError{Message: "Row not found"}
+
+	_, err = tx.Exec(`UPDATE csv_rows SET deleted_at = NOW() WHERE id = $1`, rowID)
+	if err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
 	}
 
 	return nil
 }
 
+// checkVersion rejects a write made against an older version of row. The
+// conflict carries the current row so the client can merge and retry.
+func checkVersion(row *response.GetRowsResponse, version *int) error {
+	if version == nil || *version == row.Version {
+		return nil
+	}
 
-//
-// // Enhanced GetRows with optional pagination and search
-// func GetRowsWithPagination(userID, fileID int, limit, offset int, searchTerm string) ([]*response.GetRowsResponse, int, error) {
-// 	// Verify file ownership
-// 	var fileExists bool
-// 	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM files WHERE id = $1 AND user_id = $2)", fileID, userID).Scan(&fileExists)
-// 	if err != nil {
-// 		return nil, 0, fmt.Errorf("error checking file ownership: %v", err)
-// 	}
-// 	if !fileExists {
-// 		return nil, 0, fmt.Errorf("file not found or access denied")
-// 	}
-
-// 	// Build query with search
-// 	baseQuery := `
-// 		FROM csv_rows 
-// 		WHERE file_id = $1`
-	
-// 	args := []interface{}{fileID}
-// 	argCount := 1
-
-// 	if searchTerm != "" {
-// 		argCount++
-// 		baseQuery += fmt.Sprintf(" AND input_text ILIKE $%d", argCount)
-// 		args = append(args, "%"+searchTerm+"%")
-// 	}
-
-// 	// Get total count
-// 	var totalCount int
-// 	countQuery := "SELECT COUNT(*) " + baseQuery
-// 	err = db.DB.QueryRow(countQuery, args...).Scan(&totalCount)
-// 	if err != nil {
-// 		return nil, 0, fmt.Errorf("error getting total count: %v", err)
-// 	}
-
-// 	// Get paginated results
-// 	dataQuery := `
-// 		SELECT id, position, input_text ` + baseQuery + `
-// 		ORDER BY position ASC 
-// 		LIMIT $%d OFFSET $%d`
-	
-// 	argCount++
-// 	args = append(args, limit)
-// 	argCount++
-// 	args = append(args, offset)
-	
-// 	dataQuery = fmt.Sprintf(dataQuery, argCount-1, argCount)
-	
-// 	rows, err := db.DB.Query(dataQuery, args...)
-// 	if err != nil {
-// 		return nil, 0, fmt.Errorf("error fetching rows: %v", err)
-// 	}
-// 	defer rows.Close()
-
-// 	var result []*response.GetRowsResponse
-// 	for rows.Next() {
-// 		var row response.GetRowsResponse
-// 		err := rows.Scan(&row.Id, &row.Position, &row.InputText)
-// 		if err != nil {
-// 			return nil, 0, fmt.Errorf("error scanning row: %v", err)
-// 		}
-// 		result = append(result, &row)
-// 	}
-
-// 	if err = rows.Err(); err != nil {
-// 		return nil, 0, fmt.Errorf("error iterating rows: %v", err)
-// 	}
-
-// 	return result, totalCount, nil
-// }
\ No newline at end of file
+	return &runtime_errors.ConflictError{
+		Message: fmt.Sprintf("Row has changed: expected version %d, current version is %d", *version, row.Version),
+		Current: row,
+	}
+}
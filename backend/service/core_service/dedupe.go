@@ -0,0 +1,99 @@
+package core_service
+
+import (
+	"backend/internal/runtime_errors"
+	"backend/payloads/request"
+	"backend/payloads/response"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// DedupeService finds groups of a file's rows with the same value in one
+// column, optionally after collapsing whitespace and case. With Delete set,
+// every row but the first of each group in file order goes to the trash.
+func DedupeService(userID, fileID int, dedupe request.DedupeRequest) (*response.DedupeResponse, error) {
+	column := dedupe.Column
+	if column == "" {
+		column = "input_text"
+	}
+
+	where := whereClause{}
+	where.add("csv_file_id = %s", fileID)
+	where.add("deleted_at IS NULL")
+	key := "input_text"
+	if column != "input_text" {
+		where.add("data ? %s", column)
+		key = fmt.Sprintf("data->>$%d::text", len(where.args))
+	}
+	if dedupe.Normalize {
+		key = `lower(btrim(regexp_replace(` + key + `, '\s+', ' ', 'g')))`
+	}
+
+	result := response.DedupeResponse{Groups: []response.DuplicateGroup{}}
+	err := withTx(func(tx *sql.Tx) error {
+		var err error
+		if dedupe.Delete {
+			err = beginOperation(tx, userID, fileID, "dedupe")
+		} else {
+			err = lockOwnedFile(tx, fileID, userID)
+		}
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(`
+			SELECT key, array_agg(id ORDER BY rank, id)
+			FROM (
+				SELECT id, rank, `+key+` AS key FROM csv_rows
+				WHERE `+where.String()+`
+			) keyed
+			GROUP BY key
+			HAVING COUNT(*) > 1
+			ORDER BY MIN(rank)`,
+			where.args...,
+		)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		var duplicates []int64
+		for rows.Next() {
+			var group response.DuplicateGroup
+			var value sql.NullString
+			if err := rows.Scan(&value, pq.Array(&group.RowIDs)); err != nil {
+				rows.Close()
+				return &runtime_errors.InternalServerError{Message: err.Error()}
+			}
+			group.Value = value.String
+			result.Groups = append(result.Groups, group)
+			duplicates = append(duplicates, group.RowIDs[1:]...)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		result.Duplicates = int64(len(duplicates))
+
+		if !dedupe.Delete || len(duplicates) == 0 {
+			return nil
+		}
+
+		deleted, err := tx.Exec(`UPDATE csv_rows SET deleted_at = NOW() WHERE id = ANY($1)`, pq.Array(duplicates))
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		result.Deleted, err = deleted.RowsAffected()
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,79 @@
+package core_service
+
+import (
+	"backend/internal/rowquery"
+	"backend/internal/runtime_errors"
+	"backend/payloads/request"
+	"backend/payloads/response"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// DeleteRowsService moves every row of a file matching all the given filters
+// to the trash, or only counts them on a dry run.
+func DeleteRowsService(userID, fileID int, filter request.DeleteRowsRequest) (*response.DeleteRowsResponse, error) {
+	where := whereClause{}
+	where.add("csv_file_id = %s", fileID)
+	where.add("deleted_at IS NULL")
+	if len(filter.RowIDs) > 0 {
+		ids := make([]int64, len(filter.RowIDs))
+		for i, id := range filter.RowIDs {
+			ids[i] = int64(id)
+		}
+		where.add("id = ANY(%s)", pq.Array(ids))
+	}
+	if filter.MinPosition != nil {
+		where.add("position >= %s", *filter.MinPosition)
+	}
+	if filter.MaxPosition != nil {
+		where.add("position <= %s", *filter.MaxPosition)
+	}
+	if filter.Contains != "" {
+		where.add("input_text ILIKE %s", rowquery.LikePattern(filter.Contains))
+	}
+	if filter.Empty {
+		where.add(`input_text ~ '^\s*$'`)
+	}
+
+	if len(where.conditions) == 2 {
+		return nil, &runtime_errors.BadRequestError{
+			Message: "At least one of row_ids, min_position, max_position, contains or empty is required",
+		}
+	}
+
+	result := response.DeleteRowsResponse{DryRun: filter.DryRun}
+	err := withTx(func(tx *sql.Tx) error {
+		if filter.DryRun {
+			if err := lockOwnedFile(tx, fileID, userID); err != nil {
+				return err
+			}
+
+			err := tx.QueryRow("SELECT COUNT(*) FROM csv_rows WHERE "+where.String(), where.args...).Scan(&result.Deleted)
+			if err != nil {
+				return &runtime_errors.InternalServerError{Message: err.Error()}
+			}
+			return nil
+		}
+
+		if err := beginOperation(tx, userID, fileID, "delete_rows"); err != nil {
+			return err
+		}
+
+		deleted, err := tx.Exec("UPDATE csv_rows SET deleted_at = NOW() WHERE "+where.String(), where.args...)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		result.Deleted, err = deleted.RowsAffected()
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
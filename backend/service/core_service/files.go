@@ -0,0 +1,154 @@
+package core_service
+
+import (
+	"backend/internal/db"
+	"backend/internal/lexorank"
+	"backend/internal/runtime_errors"
+	"backend/payloads/request"
+	"backend/payloads/response"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// fileColumns are the csv_table columns scanFile reads, in order.
+const fileColumns = `id, file_name, uploaded_at, change_count, modified_at, description, metadata`
+
+// maxFileNameLength matches csv_table.file_name.
+const maxFileNameLength = 200
+
+// checkFileNameLength rejects a name that does not fit in csv_table.
+func checkFileNameLength(name string) error {
+	if utf8.RuneCountInString(name) > maxFileNameLength {
+		return &runtime_errors.BadRequestError{
+			Message: fmt.Sprintf("File name is too long, the limit is %d characters", maxFileNameLength),
+		}
+	}
+	return nil
+}
+
+func scanFile(s rowScanner, file *response.GetFilesResponse) error {
+	return s.Scan(&file.ID, &file.Filename, &file.UploadedAt, &file.ChangeCount, &file.ModifiedAt,
+		&file.Description, &file.Metadata)
+}
+
+// FileVersionService returns a file's change counter and the time it last
+// changed. Both move on every change to the file's rows or row labels, to
+// its label names and to the file's own details (migrations 015, 017 and
+// 019).
+func FileVersionService(userID, fileID int) (int64, time.Time, error) {
+	var changeCount int64
+	var modifiedAt time.Time
+	err := db.DB.QueryRow(`
+		SELECT change_count, modified_at FROM csv_table
+		WHERE id = $1 AND uploaded_by = $2 AND deleted_at IS NULL`,
+		fileID, userID,
+	).Scan(&changeCount, &modifiedAt)
+	if err == sql.ErrNoRows {
+		return 0, time.Time{}, fileAccessError(db.DB, fileID, userID)
+	}
+	if err != nil {
+		return 0, time.Time{}, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return changeCount, modifiedAt, nil
+}
+
+// copyRowsToNewFile creates a file owned by userID holding copies of rows,
+// in the given order, and returns its id. The new file keeps the column
+// names of sourceFileID, the file the rows came from.
+func copyRowsToNewFile(tx *sql.Tx, userID int, sourceFileID int, fileName string, rows []response.GetRowsResponse) (int64, error) {
+	var fileID int64
+	err := tx.QueryRow(`
+		INSERT INTO csv_table (file_name, uploaded_by, column_names)
+		SELECT $1, $2, column_names FROM csv_table WHERE id = $3
+		RETURNING id`,
+		fileName, userID, sourceFileID,
+	).Scan(&fileID)
+	if err != nil {
+		return 0, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	positions := make([]float64, len(rows))
+	ranks := make([]string, len(rows))
+	texts := make([]string, len(rows))
+	data := make([]string, len(rows))
+	for i, row := range rows {
+		positions[i] = float64(i+1) * positionStep
+		ranks[i] = lexorank.Ordinal(i + 1)
+		texts[i] = row.InputText
+		data[i] = string(row.Data)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO csv_rows (csv_file_id, position, rank, input_text, data)
+		SELECT $1, v.position, v.rank, v.input_text, NULLIF(v.data, '')::jsonb
+		FROM unnest($2::numeric[], $3::text[], $4::text[], $5::text[])
+			AS v(position, rank, input_text, data)`,
+		fileID, pq.Array(positions), pq.Array(ranks), pq.Array(texts), pq.Array(data),
+	)
+	if err != nil {
+		return 0, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return fileID, nil
+}
+
+// UpdateFileService renames a file or changes its description or metadata,
+// as one undoable operation.
+func UpdateFileService(userID, fileID int, file request.FileRequest) (*response.GetFilesResponse, error) {
+	if file.FileName == nil && file.Description == nil && file.Metadata == nil {
+		return nil, &runtime_errors.BadRequestError{Message: "Nothing to update"}
+	}
+
+	if file.FileName != nil {
+		name := strings.TrimSpace(*file.FileName)
+		if name == "" {
+			return nil, &runtime_errors.BadRequestError{Message: "File name cannot be empty"}
+		}
+		if err := checkFileNameLength(name); err != nil {
+			return nil, err
+		}
+		file.FileName = &name
+	}
+
+	var metadata any
+	if file.Metadata != nil {
+		var object map[string]any
+		if err := json.Unmarshal(file.Metadata, &object); err != nil || object == nil {
+			return nil, &runtime_errors.BadRequestError{Message: "metadata must be a JSON object"}
+		}
+		metadata = string(file.Metadata)
+	}
+
+	var updated response.GetFilesResponse
+	err := withTx(func(tx *sql.Tx) error {
+		if err := beginOperation(tx, userID, fileID, "update_file"); err != nil {
+			return err
+		}
+
+		err := scanFile(tx.QueryRow(`
+			UPDATE csv_table SET
+				file_name = COALESCE($1, file_name),
+				description = CASE WHEN $2::text IS NULL THEN description ELSE NULLIF($2, '') END,
+				metadata = COALESCE($3::jsonb, metadata)
+			WHERE id = $4
+			RETURNING `+fileColumns,
+			file.FileName, file.Description, metadata, fileID,
+		), &updated)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
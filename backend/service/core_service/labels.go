@@ -0,0 +1,277 @@
+package core_service
+
+import (
+	"backend/internal/db"
+	"backend/internal/runtime_errors"
+	"backend/payloads/request"
+	"backend/payloads/response"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// uniqueViolation is the Postgres error code for a broken UNIQUE constraint.
+const uniqueViolation = "23505"
+
+// ListLabelsService lists a file's labels with how many live rows carry each.
+func ListLabelsService(userID, fileID int) ([]response.LabelResponse, error) {
+	if err := checkOwnedFile(db.DB, fileID, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT l.id, l.name, l.color, l.is_status,
+			(SELECT COUNT(*) FROM csv_row_labels rl
+			 JOIN csv_rows r ON r.id = rl.row_id
+			 WHERE rl.label_id = l.id AND r.deleted_at IS NULL)
+		FROM csv_labels l
+		JOIN csv_table f ON f.id = l.csv_file_id
+		WHERE l.csv_file_id = $1 AND f.uploaded_by = $2 AND f.deleted_at IS NULL
+		ORDER BY l.is_status DESC, l.name`,
+		fileID, userID,
+	)
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	defer rows.Close()
+
+	labels := []response.LabelResponse{}
+	for rows.Next() {
+		var label response.LabelResponse
+		if err := rows.Scan(&label.ID, &label.Name, &label.Color, &label.IsStatus, &label.RowCount); err != nil {
+			return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		labels = append(labels, label)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return labels, nil
+}
+
+func CreateLabelService(userID, fileID int, label request.LabelRequest) (*response.LabelResponse, error) {
+	label.Name = strings.TrimSpace(label.Name)
+	if label.Name == "" {
+		return nil, &runtime_errors.BadRequestError{Message: "Label name cannot be empty"}
+	}
+
+	var created response.LabelResponse
+	err := withTx(func(tx *sql.Tx) error {
+		if err := lockOwnedFile(tx, fileID, userID); err != nil {
+			return err
+		}
+
+		err := tx.QueryRow(`
+			INSERT INTO csv_labels (csv_file_id, name, color, is_status)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, name, color, is_status`,
+			fileID, label.Name, label.Color, label.IsStatus,
+		).Scan(&created.ID, &created.Name, &created.Color, &created.IsStatus)
+		return labelWriteError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+func UpdateLabelService(userID, fileID, labelID int, label request.LabelRequest) (*response.LabelResponse, error) {
+	label.Name = strings.TrimSpace(label.Name)
+	if label.Name == "" {
+		return nil, &runtime_errors.BadRequestError{Message: "Label name cannot be empty"}
+	}
+
+	var updated response.LabelResponse
+	err := withTx(func(tx *sql.Tx) error {
+		if err := lockOwnedFile(tx, fileID, userID); err != nil {
+			return err
+		}
+
+		// Making a label a status must not leave a row with two statuses.
+		if label.IsStatus {
+			var conflicts int64
+			err := tx.QueryRow(`
+				SELECT COUNT(DISTINCT rl.row_id) FROM csv_row_labels rl
+				JOIN csv_row_labels other ON other.row_id = rl.row_id AND other.label_id <> rl.label_id
+				JOIN csv_labels l ON l.id = other.label_id AND l.is_status
+				WHERE rl.label_id = $1 AND l.csv_file_id = $2`,
+				labelID, fileID,
+			).Scan(&conflicts)
+			if err != nil {
+				return &runtime_errors.InternalServerError{Message: err.Error()}
+			}
+			if conflicts > 0 {
+				return &runtime_errors.ConflictError{
+					Message: fmt.Sprintf("%d rows with this label already have another status label", conflicts),
+				}
+			}
+		}
+
+		err := tx.QueryRow(`
+			UPDATE csv_labels SET name = $1, color = $2, is_status = $3
+			WHERE id = $4 AND csv_file_id = $5
+			RETURNING id, name, color, is_status`,
+			label.Name, label.Color, label.IsStatus, labelID, fileID,
+		).Scan(&updated.ID, &updated.Name, &updated.Color, &updated.IsStatus)
+		return labelWriteError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// DeleteLabelService deletes a label and detaches it from every row.
+func DeleteLabelService(userID, fileID, labelID int) error {
+	return withTx(func(tx *sql.Tx) error {
+		if err := lockOwnedFile(tx, fileID, userID); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(`DELETE FROM csv_labels WHERE id = $1 AND csv_file_id = $2`, labelID, fileID)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		if deleted == 0 {
+			return &runtime_errors.BadRequestError{Message: "Label not found"}
+		}
+		return nil
+	})
+}
+
+// AttachLabelService puts a label on rows. Attaching a status label replaces
+// whatever other status the rows had. It returns how many rows changed.
+func AttachLabelService(userID, fileID, labelID int, rowIDs []int) (int64, error) {
+	var attached int64
+	err := withTx(func(tx *sql.Tx) error {
+		if err := lockOwnedFile(tx, fileID, userID); err != nil {
+			return err
+		}
+
+		isStatus, err := labelIsStatus(tx, fileID, labelID)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]int64, len(rowIDs))
+		for i, id := range rowIDs {
+			ids[i] = int64(id)
+		}
+		if err := checkRowsInFile(tx, fileID, ids); err != nil {
+			return err
+		}
+
+		if isStatus {
+			_, err = tx.Exec(`
+				DELETE FROM csv_row_labels rl
+				USING csv_labels l
+				WHERE l.id = rl.label_id AND l.is_status AND l.id <> $1
+					AND rl.row_id = ANY($2)`,
+				labelID, pq.Array(ids))
+			if err != nil {
+				return &runtime_errors.InternalServerError{Message: err.Error()}
+			}
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO csv_row_labels (row_id, label_id, labelled_by)
+			SELECT id, $1, $3 FROM unnest($2::bigint[]) AS id
+			ON CONFLICT (row_id, label_id) DO NOTHING`,
+			labelID, pq.Array(ids), userID)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		attached, err = result.RowsAffected()
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return attached, nil
+}
+
+// DetachLabelService takes a label off rows and returns how many rows
+// changed.
+func DetachLabelService(userID, fileID, labelID int, rowIDs []int) (int64, error) {
+	var detached int64
+	err := withTx(func(tx *sql.Tx) error {
+		if err := lockOwnedFile(tx, fileID, userID); err != nil {
+			return err
+		}
+
+		if _, err := labelIsStatus(tx, fileID, labelID); err != nil {
+			return err
+		}
+
+		ids := make([]int64, len(rowIDs))
+		for i, id := range rowIDs {
+			ids[i] = int64(id)
+		}
+
+		result, err := tx.Exec(`
+			DELETE FROM csv_row_labels
+			WHERE label_id = $1 AND row_id = ANY($2)`,
+			labelID, pq.Array(ids))
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		detached, err = result.RowsAffected()
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return detached, nil
+}
+
+// labelIsStatus checks that the label belongs to the file and reports
+// whether it is a status label.
+func labelIsStatus(tx *sql.Tx, fileID, labelID int) (bool, error) {
+	var isStatus bool
+	err := tx.QueryRow(`
+		SELECT is_status FROM csv_labels
+		WHERE id = $1 AND csv_file_id = $2`,
+		labelID, fileID,
+	).Scan(&isStatus)
+	if err == sql.ErrNoRows {
+		return false, &runtime_errors.BadRequestError{Message: "Label not found"}
+	}
+	if err != nil {
+		return false, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return isStatus, nil
+}
+
+func labelWriteError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if err == sql.ErrNoRows {
+		return &runtime_errors.BadRequestError{Message: "Label not found"}
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
+		return &runtime_errors.BadRequestError{Message: "A label with that name already exists"}
+	}
+	return &runtime_errors.InternalServerError{Message: err.Error()}
+}
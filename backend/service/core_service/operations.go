@@ -0,0 +1,239 @@
+package core_service
+
+import (
+	"backend/internal/runtime_errors"
+	"backend/payloads/response"
+	"database/sql"
+	"fmt"
+)
+
+// maxUndoDepth is how many operations per user and file are kept for undo.
+const maxUndoDepth = 100
+
+// beginOperation locks a file the user owns and starts recording every row
+// and file change made in tx as one undoable operation of the given kind.
+// The recording itself is done by the csv_rows and csv_table triggers
+// (migration 007), keyed on the transaction-local uptexty.operation_id.
+func beginOperation(tx *sql.Tx, userID, fileID int, kind string) error {
+	if err := lockOwnedFile(tx, fileID, userID); err != nil {
+		return err
+	}
+
+	// A new operation makes anything the user undid unreachable for redo.
+	_, err := tx.Exec(`
+		DELETE FROM csv_operations
+		WHERE csv_file_id = $1 AND user_id = $2 AND undone`,
+		fileID, userID)
+	if err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	var operationID int64
+	err = tx.QueryRow(`
+		INSERT INTO csv_operations (csv_file_id, user_id, kind)
+		VALUES ($1, $2, $3)
+		RETURNING id`,
+		fileID, userID, kind,
+	).Scan(&operationID)
+	if err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	_, err = tx.Exec(`SELECT set_config('uptexty.operation_id', $1, true)`, fmt.Sprint(operationID))
+	if err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM csv_operations
+		WHERE csv_file_id = $1 AND user_id = $2 AND id <= (
+			SELECT id FROM csv_operations
+			WHERE csv_file_id = $1 AND user_id = $2
+			ORDER BY id DESC
+			OFFSET $3 LIMIT 1
+		)`,
+		fileID, userID, maxUndoDepth)
+	if err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return nil
+}
+
+// replayDirection names the columns an undo or redo checks against and
+// writes back.
+type replayDirection struct {
+	expectRow, applyRow   string
+	expectFile, applyFile string
+}
+
+var (
+	undoDirection = replayDirection{"after_state", "before_state", "file_after", "file_before"}
+	redoDirection = replayDirection{"before_state", "after_state", "file_before", "file_after"}
+)
+
+// UndoService reverts the user's most recent operation on a file.
+func UndoService(userID, fileID int) (*response.UndoResponse, error) {
+	return replayOperation(userID, fileID, undoDirection, `
+		SELECT id, kind FROM csv_operations
+		WHERE csv_file_id = $1 AND user_id = $2 AND NOT undone
+		ORDER BY id DESC LIMIT 1
+		FOR UPDATE`)
+}
+
+// RedoService reapplies the user's most recently undone operation on a file.
+func RedoService(userID, fileID int) (*response.UndoResponse, error) {
+	return replayOperation(userID, fileID, redoDirection, `
+		SELECT id, kind FROM csv_operations
+		WHERE csv_file_id = $1 AND user_id = $2 AND undone
+		ORDER BY id LIMIT 1
+		FOR UPDATE`)
+}
+
+// replayOperation moves the operation picked by pickQuery in the given
+// direction. Rows and the file must still be exactly as the operation left
+// them (or found them, for a redo); otherwise someone changed them since and
+// a ConflictError is returned.
+func replayOperation(userID, fileID int, dir replayDirection, pickQuery string) (*response.UndoResponse, error) {
+	var result response.UndoResponse
+	err := withTx(func(tx *sql.Tx) error {
+		// The file may be in the trash when undoing its deletion.
+		var id int64
+		err := tx.QueryRow(`
+			SELECT id FROM csv_table
+			WHERE id = $1 AND uploaded_by = $2
+			FOR UPDATE`, fileID, userID).Scan(&id)
+		if err == sql.ErrNoRows {
+			return fileAccessError(tx, fileID, userID)
+		}
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		err = tx.QueryRow(pickQuery, fileID, userID).Scan(&result.OperationID, &result.Kind)
+		if err == sql.ErrNoRows {
+			return &runtime_errors.BadRequestError{Message: "Nothing to replay"}
+		}
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		if err := checkReplayConflicts(tx, result.OperationID, dir); err != nil {
+			return err
+		}
+
+		result.RowsChanged, err = applyReplay(tx, result.OperationID, dir)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`UPDATE csv_operations SET undone = NOT undone WHERE id = $1`, result.OperationID)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func checkReplayConflicts(tx *sql.Tx, operationID int64, dir replayDirection) error {
+	// A NULL state means the row did not exist; a trashed row counts as that.
+	var rowID int64
+	err := tx.QueryRow(fmt.Sprintf(`
+		SELECT o.row_id FROM csv_operation_rows o
+		LEFT JOIN csv_rows r ON r.id = o.row_id
+		WHERE o.operation_id = $1 AND NOT (
+			CASE WHEN o.%[1]s IS NULL THEN r.id IS NULL OR r.deleted_at IS NOT NULL
+			ELSE r.id IS NOT NULL AND csv_row_state(r) = o.%[1]s END
+		)
+		LIMIT 1`, dir.expectRow),
+		operationID,
+	).Scan(&rowID)
+	if err == nil {
+		return &runtime_errors.ConflictError{
+			Message: fmt.Sprintf("Row %d has changed since, cannot replay", rowID),
+		}
+	}
+	if err != sql.ErrNoRows {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	var fileChanged bool
+	err = tx.QueryRow(fmt.Sprintf(`
+		SELECT csv_file_state(f) <> o.%[1]s FROM csv_operations o
+		JOIN csv_table f ON f.id = o.csv_file_id
+		WHERE o.id = $1 AND o.%[1]s IS NOT NULL`, dir.expectFile),
+		operationID,
+	).Scan(&fileChanged)
+	if err != nil && err != sql.ErrNoRows {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	if fileChanged {
+		return &runtime_errors.ConflictError{Message: "File has changed since, cannot replay"}
+	}
+
+	return nil
+}
+
+// applyReplay writes the recorded states back. uptexty.operation_id is not
+// set here, so the triggers do not log the replay as a new operation.
+func applyReplay(tx *sql.Tx, operationID int64, dir replayDirection) (int64, error) {
+	restored, err := tx.Exec(fmt.Sprintf(`
+		UPDATE csv_rows r SET
+			position = (o.%[1]s->>'position')::numeric,
+			rank = o.%[1]s->>'rank',
+			input_text = o.%[1]s->>'input_text',
+			data = NULLIF(o.%[1]s->'data', 'null'::jsonb),
+			deleted_at = CASE WHEN (o.%[1]s->>'deleted')::boolean
+				THEN COALESCE(r.deleted_at, NOW()) ELSE NULL END
+		FROM csv_operation_rows o
+		WHERE o.operation_id = $1 AND o.row_id = r.id AND o.%[1]s IS NOT NULL`, dir.applyRow),
+		operationID,
+	)
+	if err != nil {
+		return 0, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	// Rows the operation created go back to the trash rather than away, so a
+	// redo can bring them back with their history intact.
+	trashed, err := tx.Exec(fmt.Sprintf(`
+		UPDATE csv_rows r SET deleted_at = COALESCE(r.deleted_at, NOW())
+		FROM csv_operation_rows o
+		WHERE o.operation_id = $1 AND o.row_id = r.id AND o.%[1]s IS NULL`, dir.applyRow),
+		operationID,
+	)
+	if err != nil {
+		return 0, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(`
+		UPDATE csv_table f SET
+			file_name = o.%[1]s->>'file_name',
+			description = o.%[1]s->>'description',
+			metadata = o.%[1]s->'metadata',
+			deleted_at = CASE WHEN (o.%[1]s->>'deleted')::boolean
+				THEN COALESCE(f.deleted_at, NOW()) ELSE NULL END
+		FROM csv_operations o
+		WHERE o.id = $1 AND f.id = o.csv_file_id AND o.%[1]s IS NOT NULL`, dir.applyFile),
+		operationID,
+	)
+	if err != nil {
+		return 0, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	restoredCount, err := restored.RowsAffected()
+	if err != nil {
+		return 0, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	trashedCount, err := trashed.RowsAffected()
+	if err != nil {
+		return 0, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return restoredCount + trashedCount, nil
+}
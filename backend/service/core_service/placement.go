@@ -0,0 +1,144 @@
+package core_service
+
+import (
+	"backend/internal/lexorank"
+	"backend/internal/runtime_errors"
+	"database/sql"
+	"errors"
+)
+
+// maxRankLength caps how long a rank may grow before the file is rebalanced.
+const maxRankLength = 64
+
+// placeRow works out the position and rank for a row being inserted (rowID
+// 0) or moved. A client may ask for a rank, a legacy numeric position, or
+// neither to append at the end. Position and rank are always derived from
+// the same neighbours so both orderings agree. Trashed rows count as
+// neighbours, so restoring one never collides with rows placed since.
+func placeRow(tx *sql.Tx, fileID, rowID int, position *float64, rank string) (float64, string, error) {
+	var p float64
+	var err error
+
+	switch {
+	case rank != "":
+		if err = lexorank.Validate(rank); err != nil {
+			return 0, "", &runtime_errors.BadRequestError{Message: err.Error()}
+		}
+		p, err = positionForRank(tx, fileID, rowID, rank)
+	case position != nil:
+		p = *position
+	default:
+		p, err = positionAtEnd(tx, fileID, rowID)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	p, err = resolvePosition(tx, fileID, rowID, p)
+	if err != nil {
+		return 0, "", err
+	}
+
+	key, err := rankForPosition(tx, fileID, rowID, p, rank)
+	var dbErr *runtime_errors.InternalServerError
+	if errors.As(err, &dbErr) {
+		return 0, "", err
+	}
+	if err == nil && len(key) <= maxRankLength {
+		return p, key, nil
+	}
+
+	// Either the rank grew too long or the stored ranks disagree with the
+	// positions; renumbering the file fixes both.
+	p, err = rebalanceAround(tx, fileID, rowID, p)
+	if err != nil {
+		return 0, "", err
+	}
+
+	key, err = rankForPosition(tx, fileID, rowID, p, "")
+	if err != nil {
+		return 0, "", &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return p, key, nil
+}
+
+// positionForRank returns a position between the rows that rank falls
+// between.
+func positionForRank(tx *sql.Tx, fileID, rowID int, rank string) (float64, error) {
+	var prev, next sql.NullFloat64
+	err := tx.QueryRow(`
+		SELECT
+			(SELECT position FROM csv_rows
+			 WHERE csv_file_id = $1 AND id <> $2 AND rank <= $3
+			 ORDER BY rank DESC, id DESC LIMIT 1),
+			(SELECT position FROM csv_rows
+			 WHERE csv_file_id = $1 AND id <> $2 AND rank > $3
+			 ORDER BY rank, id LIMIT 1)`,
+		fileID, rowID, rank,
+	).Scan(&prev, &next)
+	if err != nil {
+		return 0, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return midpointPosition(prev, next), nil
+}
+
+// positionAtEnd returns a position after the last row of the file.
+func positionAtEnd(tx *sql.Tx, fileID, rowID int) (float64, error) {
+	var last sql.NullFloat64
+	err := tx.QueryRow(`
+		SELECT MAX(position) FROM csv_rows
+		WHERE csv_file_id = $1 AND id <> $2`,
+		fileID, rowID,
+	).Scan(&last)
+	if err != nil {
+		return 0, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return midpointPosition(last, sql.NullFloat64{}), nil
+}
+
+// rankForPosition returns a rank between the ranks of the rows around
+// position. If want already fits between them it is kept as is. Errors from
+// lexorank are returned unwrapped so placeRow can recover from them.
+func rankForPosition(tx *sql.Tx, fileID, rowID int, position float64, want string) (string, error) {
+	var prev, next sql.NullString
+	err := tx.QueryRow(`
+		SELECT
+			(SELECT rank FROM csv_rows
+			 WHERE csv_file_id = $1 AND id <> $2 AND position < $3
+			 ORDER BY position DESC, id DESC LIMIT 1),
+			(SELECT rank FROM csv_rows
+			 WHERE csv_file_id = $1 AND id <> $2 AND position > $3
+			 ORDER BY position, id LIMIT 1)`,
+		fileID, rowID, position,
+	).Scan(&prev, &next)
+	if err != nil {
+		return "", &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	if want != "" && (!prev.Valid || prev.String < want) && (!next.Valid || want < next.String) {
+		return want, nil
+	}
+
+	return lexorank.Between(prev.String, next.String)
+}
+
+// midpointPosition picks a position between two neighbours, either of which
+// may be missing.
+func midpointPosition(prev, next sql.NullFloat64) float64 {
+	switch {
+	case !prev.Valid && !next.Valid:
+		return positionStep
+	case !prev.Valid:
+		if next.Float64 > 0 {
+			return next.Float64 / 2
+		}
+		return next.Float64 - positionStep
+	case !next.Valid:
+		return prev.Float64 + positionStep
+	default:
+		return (prev.Float64 + next.Float64) / 2
+	}
+}
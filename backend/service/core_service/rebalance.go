@@ -0,0 +1,113 @@
+package core_service
+
+import (
+	"backend/internal/runtime_errors"
+	"database/sql"
+)
+
+const (
+	// positionStep is the spacing used for uploads and rebalanced files.
+	positionStep = 10.0
+
+	// minPositionGap is the smallest distance we accept between two
+	// neighbouring positions. csv_rows.position is NUMERIC(30,10) and the
+	// API carries positions as float64, so anything closer than this is
+	// treated as a collision and triggers a rebalance.
+	minPositionGap = 1e-6
+)
+
+// resolvePosition returns the position a row should be stored at when a
+// client asks for position. rowID is the row being moved (0 for inserts) and
+// is ignored when looking for neighbours. If position collides with, or is
+// too close to, a neighbour, the file is renumbered and a position in the
+// middle of the requested slot is returned instead.
+func resolvePosition(tx *sql.Tx, fileID, rowID int, position float64) (float64, error) {
+	var prev, next sql.NullFloat64
+	err := tx.QueryRow(`
+		SELECT
+			(SELECT MAX(position) FROM csv_rows
+			 WHERE csv_file_id = $1 AND id <> $2 AND position <= $3),
+			(SELECT MIN(position) FROM csv_rows
+			 WHERE csv_file_id = $1 AND id <> $2 AND position > $3)`,
+		fileID, rowID, position,
+	).Scan(&prev, &next)
+	if err != nil {
+		return 0, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	if (!prev.Valid || position-prev.Float64 >= minPositionGap) &&
+		(!next.Valid || next.Float64-position >= minPositionGap) {
+		return position, nil
+	}
+
+	return rebalanceAround(tx, fileID, rowID, position)
+}
+
+// rebalanceAround renumbers the file and returns the position in the middle
+// of the slot that position pointed at before the renumbering.
+func rebalanceAround(tx *sql.Tx, fileID, rowID int, position float64) (float64, error) {
+	// Remember which slot the client meant before positions change.
+	var before int
+	err := tx.QueryRow(`
+		SELECT COUNT(*) FROM csv_rows
+		WHERE csv_file_id = $1 AND id <> $2 AND position <= $3`,
+		fileID, rowID, position,
+	).Scan(&before)
+	if err != nil {
+		return 0, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	if _, err = rebalanceFile(tx, fileID, rowID); err != nil {
+		return 0, err
+	}
+
+	return float64(before)*positionStep + positionStep/2, nil
+}
+
+// rebalanceFile renumbers every row of the file, except skipRowID, to evenly
+// spaced positions and ranks while keeping the current order. Ranks use the
+// lexorank.Ordinal format. It returns the number of rows renumbered.
+func rebalanceFile(tx *sql.Tx, fileID, skipRowID int) (int64, error) {
+	result, err := tx.Exec(`
+		UPDATE csv_rows r
+		SET position = o.ordinal * $2,
+			rank = lpad(to_hex(o.ordinal), 8, '0') || 'V'
+		FROM (
+			SELECT id, ROW_NUMBER() OVER (ORDER BY rank, id) AS ordinal
+			FROM csv_rows
+			WHERE csv_file_id = $1 AND id <> $3
+		) o
+		WHERE r.id = o.id`,
+		fileID, positionStep, skipRowID,
+	)
+	if err != nil {
+		return 0, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	renumbered, err := result.RowsAffected()
+	if err != nil {
+		return 0, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return renumbered, nil
+}
+
+// RebalanceFileService forces a renumbering of all positions and ranks in a
+// file, which also shortens ranks that have grown long.
+func RebalanceFileService(userID, fileID int) (int64, error) {
+	var renumbered int64
+	err := withTx(func(tx *sql.Tx) error {
+		if err := beginOperation(tx, userID, fileID, "rebalance"); err != nil {
+			return err
+		}
+
+		var err error
+		renumbered, err = rebalanceFile(tx, fileID, 0)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return renumbered, nil
+}
@@ -0,0 +1,382 @@
+package core_service
+
+import (
+	"backend/internal/lexorank"
+	"backend/internal/runtime_errors"
+	"backend/payloads/request"
+	"backend/payloads/response"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// ReorderRowsService moves many rows of a file in one transaction. It either
+// moves a block (RowIDs, or the range FromID..ToID) to directly after
+// AfterID, or, without an anchor, rearranges RowIDs among the slots they
+// already occupy. The moved rows are returned in their new order.
+func ReorderRowsService(userID, fileID int, reorder request.ReorderRowsRequest) ([]response.GetRowsResponse, error) {
+	var moved []response.GetRowsResponse
+	err := withTx(func(tx *sql.Tx) error {
+		if err := beginOperation(tx, userID, fileID, "reorder_rows"); err != nil {
+			return err
+		}
+
+		var err error
+		moved, err = reorderRows(tx, userID, fileID, reorder)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return moved, nil
+}
+
+func reorderRows(tx *sql.Tx, userID, fileID int, reorder request.ReorderRowsRequest) ([]response.GetRowsResponse, error) {
+	ids, err := reorderTargets(tx, fileID, reorder)
+	if err != nil {
+		return nil, err
+	}
+
+	if reorder.AfterID == nil {
+		if reorder.FromID != nil {
+			return nil, &runtime_errors.BadRequestError{Message: "after_id is required when moving a range"}
+		}
+		err = permuteRows(tx, userID, fileID, ids)
+	} else {
+		err = moveRowsAfter(tx, userID, fileID, ids, *reorder.AfterID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return rowsByIDs(tx, ids)
+}
+
+// reorderTargets resolves the rows a reorder applies to, in the order they
+// should end up in.
+func reorderTargets(tx *sql.Tx, fileID int, reorder request.ReorderRowsRequest) ([]int64, error) {
+	if len(reorder.RowIDs) > 0 {
+		if reorder.FromID != nil || reorder.ToID != nil {
+			return nil, &runtime_errors.BadRequestError{Message: "Give either row_ids or from_id/to_id, not both"}
+		}
+
+		ids := make([]int64, len(reorder.RowIDs))
+		for i, id := range reorder.RowIDs {
+			ids[i] = int64(id)
+		}
+		if err := checkRowsInFile(tx, fileID, ids); err != nil {
+			return nil, err
+		}
+		return ids, nil
+	}
+
+	if reorder.FromID == nil || reorder.ToID == nil {
+		return nil, &runtime_errors.BadRequestError{Message: "row_ids or from_id/to_id are required"}
+	}
+
+	fromRank, err := rowRank(tx, fileID, *reorder.FromID)
+	if err != nil {
+		return nil, err
+	}
+	toRank, err := rowRank(tx, fileID, *reorder.ToID)
+	if err != nil {
+		return nil, err
+	}
+
+	fromID, toID := *reorder.FromID, *reorder.ToID
+	if toRank < fromRank || (toRank == fromRank && toID < fromID) {
+		fromRank, toRank = toRank, fromRank
+		fromID, toID = toID, fromID
+	}
+
+	rows, err := tx.Query(`
+		SELECT id FROM csv_rows
+		WHERE csv_file_id = $1 AND deleted_at IS NULL
+			AND (rank, id) >= ($2, $3)
+			AND (rank, id) <= ($4, $5)
+		ORDER BY rank, id`,
+		fileID, fromRank, fromID, toRank, toID,
+	)
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return ids, nil
+}
+
+// rowRank returns the rank of a row, rejecting rows outside the file.
+func rowRank(tx *sql.Tx, fileID, rowID int) (string, error) {
+	var rank string
+	err := tx.QueryRow(`
+		SELECT rank FROM csv_rows
+		WHERE id = $1 AND csv_file_id = $2 AND deleted_at IS NULL`,
+		rowID, fileID,
+	).Scan(&rank)
+	if err == sql.ErrNoRows {
+		return "", &runtime_errors.BadRequestError{
+			Message: fmt.Sprintf("Row %d is not in this file", rowID),
+		}
+	}
+	if err != nil {
+		return "", &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return rank, nil
+}
+
+// checkRowsInFile rejects duplicate ids and ids that are not rows of the file.
+func checkRowsInFile(tx *sql.Tx, fileID int, ids []int64) error {
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return &runtime_errors.BadRequestError{Message: fmt.Sprintf("Row %d listed more than once", id)}
+		}
+		seen[id] = true
+	}
+
+	rows, err := tx.Query(`
+		SELECT id FROM csv_rows
+		WHERE csv_file_id = $1 AND id = ANY($2) AND deleted_at IS NULL`,
+		fileID, pq.Array(ids),
+	)
+	if err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		delete(seen, id)
+	}
+	if err := rows.Err(); err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	for _, id := range ids {
+		if seen[id] {
+			return &runtime_errors.BadRequestError{Message: fmt.Sprintf("Row %d is not in this file", id)}
+		}
+	}
+
+	return nil
+}
+
+// permuteRows hands the slots currently held by ids back out in the order
+// of ids, so a selection can be sorted without touching other rows.
+func permuteRows(tx *sql.Tx, userID, fileID int, ids []int64) error {
+	rows, err := tx.Query(`
+		SELECT position, rank FROM csv_rows
+		WHERE csv_file_id = $1 AND id = ANY($2)
+		ORDER BY rank, id`,
+		fileID, pq.Array(ids),
+	)
+	if err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	defer rows.Close()
+
+	positions := make([]float64, 0, len(ids))
+	ranks := make([]string, 0, len(ids))
+	for rows.Next() {
+		var position float64
+		var rank string
+		if err := rows.Scan(&position, &rank); err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		positions = append(positions, position)
+		ranks = append(ranks, rank)
+	}
+	if err := rows.Err(); err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return writePlacements(tx, userID, fileID, ids, positions, ranks)
+}
+
+// moveRowsAfter moves ids, in order, to directly after afterID (0 for the
+// top of the file).
+func moveRowsAfter(tx *sql.Tx, userID, fileID int, ids []int64, afterID int) error {
+	for _, id := range ids {
+		if id == int64(afterID) {
+			return &runtime_errors.BadRequestError{Message: "after_id cannot be one of the moved rows"}
+		}
+	}
+
+	positions, ranks, rebalance, err := slotsAfter(tx, fileID, afterID, ids, len(ids))
+	if err != nil {
+		return err
+	}
+
+	if err = writePlacements(tx, userID, fileID, ids, positions, ranks); err != nil {
+		return err
+	}
+
+	if rebalance {
+		_, err = rebalanceFile(tx, fileID, 0)
+	}
+	return err
+}
+
+// slotsAfter returns n ascending positions and ranks that fit between the
+// anchor row (0 for the top of the file) and the row after it. Rows in
+// exclude are not treated as neighbours; trashed rows are, so they keep
+// their slot for a restore. If the slots come out too tight,
+// rebalance is set and the caller should rebalance the file once the rows
+// are written; the ranks alone are enough to keep them in order until then.
+func slotsAfter(tx *sql.Tx, fileID, afterID int, exclude []int64, n int) ([]float64, []string, bool, error) {
+	var prevPos, nextPos sql.NullFloat64
+	var prevRank, nextRank sql.NullString
+
+	// pq sends a nil slice as NULL, which would make NOT (id = ANY(...)) NULL.
+	if exclude == nil {
+		exclude = []int64{}
+	}
+
+	if afterID != 0 {
+		err := tx.QueryRow(`
+			SELECT position, rank FROM csv_rows
+			WHERE id = $1 AND csv_file_id = $2 AND deleted_at IS NULL`,
+			afterID, fileID,
+		).Scan(&prevPos, &prevRank)
+		if err == sql.ErrNoRows {
+			return nil, nil, false, &runtime_errors.BadRequestError{
+				Message: fmt.Sprintf("Anchor row %d is not in this file", afterID),
+			}
+		}
+		if err != nil {
+			return nil, nil, false, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+	}
+
+	err := tx.QueryRow(`
+		SELECT position, rank FROM csv_rows
+		WHERE csv_file_id = $1 AND NOT (id = ANY($2))
+			AND ($3::text IS NULL OR (rank, id) > ($3, $4))
+		ORDER BY rank, id
+		LIMIT 1`,
+		fileID, pq.Array(exclude), prevRank, afterID,
+	).Scan(&nextPos, &nextRank)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, nil, false, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	ranks, err := lexorank.BetweenN(prevRank.String, nextRank.String, n)
+	if errors.Is(err, lexorank.ErrOutOfOrder) {
+		// Neighbours share a rank; renumber and look again.
+		if _, err = rebalanceFile(tx, fileID, 0); err != nil {
+			return nil, nil, false, err
+		}
+		return slotsAfter(tx, fileID, afterID, exclude, n)
+	}
+	if err != nil {
+		return nil, nil, false, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	lo, hi := 0.0, positionStep*float64(n+1)
+	switch {
+	case prevPos.Valid && nextPos.Valid:
+		lo, hi = prevPos.Float64, nextPos.Float64
+	case prevPos.Valid:
+		lo, hi = prevPos.Float64, prevPos.Float64+positionStep*float64(n+1)
+	case nextPos.Valid && nextPos.Float64 > 0:
+		hi = nextPos.Float64
+	case nextPos.Valid:
+		lo, hi = nextPos.Float64-positionStep*float64(n+1), nextPos.Float64
+	}
+
+	step := (hi - lo) / float64(n+1)
+	positions := make([]float64, n)
+	for i := range positions {
+		positions[i] = lo + step*float64(i+1)
+	}
+
+	rebalance := step < minPositionGap
+	for _, rank := range ranks {
+		if len(rank) > maxRankLength {
+			rebalance = true
+			break
+		}
+	}
+
+	return positions, ranks, rebalance, nil
+}
+
+// writePlacements stores positions[i] and ranks[i] on row ids[i] and
+// records each row that actually moved as a revision by userID.
+func writePlacements(tx *sql.Tx, userID, fileID int, ids []int64, positions []float64, ranks []string) error {
+	_, err := tx.Exec(`
+		WITH v AS (
+			SELECT * FROM unnest($1::bigint[], $2::numeric[], $3::text[]) AS v(id, position, rank)
+		), old AS (
+			SELECT r.id, r.position, r.rank FROM csv_rows r
+			JOIN v ON v.id = r.id
+			WHERE r.csv_file_id = $4
+		), moved AS (
+			UPDATE csv_rows r
+			SET position = v.position, rank = v.rank
+			FROM v
+			WHERE r.id = v.id AND r.csv_file_id = $4
+			RETURNING r.id, r.position, r.rank, r.input_text
+		)
+		INSERT INTO csv_row_revisions
+			(row_id, csv_file_id, changed_by, action,
+			 old_text, new_text, old_position, new_position, old_rank, new_rank)
+		SELECT moved.id, $4, $5, $6,
+			moved.input_text, moved.input_text, old.position, moved.position, old.rank, moved.rank
+		FROM moved JOIN old ON old.id = moved.id
+		WHERE old.rank <> moved.rank OR old.position <> moved.position`,
+		pq.Array(ids), pq.Array(positions), pq.Array(ranks), fileID, userID, revisionMove,
+	)
+	if err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return nil
+}
+
+// rowsByIDs returns the given rows in file order.
+func rowsByIDs(tx *sql.Tx, ids []int64) ([]response.GetRowsResponse, error) {
+	rows, err := tx.Query(`
+		SELECT `+rowColumns+` FROM csv_rows
+		WHERE id = ANY($1)
+		ORDER BY rank, id`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	defer rows.Close()
+
+	var responseList []response.GetRowsResponse
+	for rows.Next() {
+		var row response.GetRowsResponse
+		if err := scanRow(rows, &row); err != nil {
+			return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		responseList = append(responseList, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return responseList, nil
+}
@@ -0,0 +1,196 @@
+package core_service
+
+import (
+	"backend/internal/runtime_errors"
+	"backend/payloads/request"
+	"backend/payloads/response"
+	"database/sql"
+	"encoding/json"
+	"regexp"
+
+	"github.com/lib/pq"
+)
+
+// ReplaceService replaces every match of a pattern in one column of a
+// file's rows. In preview mode nothing is written; otherwise all rows change
+// in one transaction and each changed row gets a revision.
+func ReplaceService(userID, fileID int, replace request.ReplaceRequest) (*response.ReplaceResponse, error) {
+	if replace.Pattern == "" {
+		return nil, &runtime_errors.BadRequestError{Message: "Pattern cannot be empty"}
+	}
+
+	expr := replace.Pattern
+	if !replace.Regex {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if replace.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, &runtime_errors.BadRequestError{Message: "Invalid pattern: " + err.Error()}
+	}
+
+	// Literal replacements are taken as is; regex ones expand $1 and ${name}.
+	replaceAll := re.ReplaceAllLiteralString
+	if replace.Regex {
+		replaceAll = re.ReplaceAllString
+	}
+
+	column := replace.Column
+	if column == "" {
+		column = "input_text"
+	}
+
+	where := whereClause{}
+	where.add("csv_file_id = %s", fileID)
+	where.add("deleted_at IS NULL")
+	if column != "input_text" {
+		where.add("data ? %s", column)
+	}
+	if len(replace.RowIDs) > 0 {
+		ids := make([]int64, len(replace.RowIDs))
+		for i, id := range replace.RowIDs {
+			ids[i] = int64(id)
+		}
+		where.add("id = ANY(%s)", pq.Array(ids))
+	}
+	if replace.MinPosition != nil {
+		where.add("position >= %s", *replace.MinPosition)
+	}
+	if replace.MaxPosition != nil {
+		where.add("position <= %s", *replace.MaxPosition)
+	}
+
+	result := response.ReplaceResponse{Preview: replace.Preview, Rows: []response.ReplaceRowResult{}}
+	err = withTx(func(tx *sql.Tx) error {
+		var err error
+		if replace.Preview {
+			err = lockOwnedFile(tx, fileID, userID)
+		} else {
+			err = beginOperation(tx, userID, fileID, "replace")
+		}
+		if err != nil {
+			return err
+		}
+
+		query := "SELECT " + rowColumns + " FROM csv_rows WHERE " + where.String() + " ORDER BY rank, id"
+		if !replace.Preview {
+			query += " FOR UPDATE"
+		}
+		rows, err := tx.Query(query, where.args...)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		var matched []response.GetRowsResponse
+		for rows.Next() {
+			var row response.GetRowsResponse
+			if err := scanRow(rows, &row); err != nil {
+				rows.Close()
+				return &runtime_errors.InternalServerError{Message: err.Error()}
+			}
+
+			before, err := columnText(&row, column)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			matches := len(re.FindAllStringIndex(before, -1))
+			if matches == 0 {
+				continue
+			}
+			after := replaceAll(before, replace.Replacement)
+			if after == before {
+				continue
+			}
+
+			matched = append(matched, row)
+			result.Replacements += matches
+			result.Rows = append(result.Rows, response.ReplaceRowResult{
+				RowID:   row.Id,
+				Before:  before,
+				After:   after,
+				Matches: matches,
+			})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		result.RowsChanged = len(result.Rows)
+
+		if replace.Preview {
+			return nil
+		}
+
+		for i := range matched {
+			updated, err := replaceColumn(tx, userID, fileID, &matched[i], column, result.Rows[i].After)
+			if err != nil {
+				return err
+			}
+			result.Rows[i].Version = updated.Version
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// columnText reads a row's input_text or one of its data columns as text.
+func columnText(row *response.GetRowsResponse, column string) (string, error) {
+	if column == "input_text" {
+		return row.InputText, nil
+	}
+
+	var columns map[string]any
+	if err := json.Unmarshal(row.Data, &columns); err != nil {
+		return "", &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	switch value := columns[column].(type) {
+	case string:
+		return value, nil
+	case nil:
+		return "", nil
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		return string(encoded), nil
+	}
+}
+
+// replaceColumn writes text into the row's column and records the change
+// as a revision.
+func replaceColumn(tx *sql.Tx, userID, fileID int, before *response.GetRowsResponse, column, text string) (*response.GetRowsResponse, error) {
+	var update *sql.Row
+	if column == "input_text" {
+		update = tx.QueryRow(`
+			UPDATE csv_rows SET input_text = $1
+			WHERE id = $2
+			RETURNING `+rowColumns,
+			text, before.Id)
+	} else {
+		update = tx.QueryRow(`
+			UPDATE csv_rows SET data = jsonb_set(data, ARRAY[$1::text], to_jsonb($2::text))
+			WHERE id = $3
+			RETURNING `+rowColumns,
+			column, text, before.Id)
+	}
+
+	var after response.GetRowsResponse
+	if err := scanRow(update, &after); err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	if err := recordRevision(tx, userID, fileID, revisionReplace, before, &after); err != nil {
+		return nil, err
+	}
+
+	return &after, nil
+}
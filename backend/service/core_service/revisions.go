@@ -0,0 +1,164 @@
+package core_service
+
+import (
+	"backend/internal/db"
+	"backend/internal/runtime_errors"
+	"backend/payloads/response"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+)
+
+// Revision actions recorded in csv_row_revisions.action.
+const (
+	revisionUpdate  = "update"
+	revisionMove    = "move"
+	revisionRestore = "restore"
+	revisionReplace = "replace"
+)
+
+// recordRevision appends a revision for a row going from before to after.
+// Nothing is recorded when the text, data and place are unchanged; data is
+// only stored when it changed.
+func recordRevision(tx *sql.Tx, userID, fileID int, action string, before, after *response.GetRowsResponse) error {
+	dataChanged := !bytes.Equal(before.Data, after.Data)
+	if before.InputText == after.InputText && before.Position == after.Position && before.Rank == after.Rank && !dataChanged {
+		return nil
+	}
+
+	var oldData, newData any
+	if dataChanged {
+		oldData, newData = jsonOrNull(before.Data), jsonOrNull(after.Data)
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO csv_row_revisions
+			(row_id, csv_file_id, changed_by, action,
+			 old_text, new_text, old_position, new_position, old_rank, new_rank,
+			 old_data, new_data)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		after.Id, fileID, userID, action,
+		before.InputText, after.InputText,
+		before.Position, after.Position,
+		before.Rank, after.Rank,
+		oldData, newData,
+	)
+	if err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return nil
+}
+
+// GetRowHistoryService lists a row's revisions, newest first.
+func GetRowHistoryService(userID, fileID, rowID int) ([]response.RowRevisionResponse, error) {
+	if err := checkOwnedFile(db.DB, fileID, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT rv.id, rv.row_id, rv.action, rv.changed_by, COALESCE(u.username, ''),
+			rv.old_text, rv.new_text, rv.old_position, rv.new_position,
+			rv.old_data, rv.new_data, rv.changed_at
+		FROM csv_row_revisions rv
+		JOIN csv_table f ON f.id = rv.csv_file_id
+		LEFT JOIN user_table u ON u.id = rv.changed_by
+		WHERE rv.row_id = $1 AND rv.csv_file_id = $2
+			AND f.uploaded_by = $3 AND f.deleted_at IS NULL
+		ORDER BY rv.id DESC`,
+		rowID, fileID, userID,
+	)
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	defer rows.Close()
+
+	history := []response.RowRevisionResponse{}
+	for rows.Next() {
+		var revision response.RowRevisionResponse
+		var changedBy sql.NullInt64
+		var oldData, newData []byte
+		err := rows.Scan(&revision.ID, &revision.RowID, &revision.Action, &changedBy, &revision.ChangedByName,
+			&revision.OldText, &revision.NewText, &revision.OldPosition, &revision.NewPosition,
+			&oldData, &newData, &revision.ChangedAt)
+		if err != nil {
+			return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		revision.ChangedBy = int(changedBy.Int64)
+		if len(oldData) > 0 {
+			revision.OldData = json.RawMessage(oldData)
+		}
+		if len(newData) > 0 {
+			revision.NewData = json.RawMessage(newData)
+		}
+		history = append(history, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return history, nil
+}
+
+// RestoreRevisionService sets a row's text, and its data when the revision
+// recorded it, back to what they were right after the given revision. The
+// row keeps its current place, since positions may have been renumbered
+// since. The restore is itself recorded as a revision.
+func RestoreRevisionService(userID, fileID, rowID, revisionID int) (*response.GetRowsResponse, error) {
+	var restored *response.GetRowsResponse
+	err := withTx(func(tx *sql.Tx) error {
+		if err := beginOperation(tx, userID, fileID, "restore_revision"); err != nil {
+			return err
+		}
+
+		var text string
+		var data []byte
+		err := tx.QueryRow(`
+			SELECT new_text, new_data FROM csv_row_revisions
+			WHERE id = $1 AND row_id = $2 AND csv_file_id = $3`,
+			revisionID, rowID, fileID,
+		).Scan(&text, &data)
+		if err == sql.ErrNoRows {
+			return &runtime_errors.BadRequestError{Message: "Revision not found"}
+		}
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		before, err := lockRow(tx, fileID, rowID)
+		if err != nil {
+			return err
+		}
+
+		var after response.GetRowsResponse
+		update := tx.QueryRow(`
+			UPDATE csv_rows SET input_text = $1, data = COALESCE($2::jsonb, data)
+			WHERE id = $3
+			RETURNING `+rowColumns,
+			text, jsonOrNull(data), rowID,
+		)
+		if err := scanRow(update, &after); err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		if err := recordRevision(tx, userID, fileID, revisionRestore, before, &after); err != nil {
+			return err
+		}
+
+		restored = &after
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return restored, nil
+}
+
+// jsonOrNull passes JSON to a query, with empty input as SQL NULL.
+func jsonOrNull(b []byte) any {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
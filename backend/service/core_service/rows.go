@@ -0,0 +1,41 @@
+package core_service
+
+import (
+	"backend/payloads/response"
+	"encoding/json"
+)
+
+// rowColumns is the csv_rows column list every row read selects, in the
+// order scanRow expects.
+const rowColumns = "id, position, rank, input_text, data, version, updated_at"
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// rowLabelsColumn selects a row's label ids; queries that list it after
+// rowColumns pass pq.Array(&row.Labels) to scanRow.
+const rowLabelsColumn = `ARRAY(SELECT label_id FROM csv_row_labels WHERE row_id = csv_rows.id ORDER BY label_id)`
+
+// numberedRows is a FROM item that reads like csv_rows but holds only the
+// live rows of one file, each with its 1-based ordinal in (rank, id) order
+// as an extra ordinal column. Its %s takes the file id. Numbering reads the
+// whole file, so queries only use it when ordinals are asked for.
+const numberedRows = `(SELECT *, row_number() OVER (ORDER BY rank, id) AS ordinal
+	FROM csv_rows WHERE csv_file_id = %s AND deleted_at IS NULL) csv_rows`
+
+// scanRow scans rowColumns into row, followed by any extra columns the
+// query selected after them.
+func scanRow(s rowScanner, row *response.GetRowsResponse, extra ...any) error {
+	var data []byte
+	dest := append([]any{&row.Id, &row.Position, &row.Rank, &row.InputText, &data, &row.Version, &row.UpdatedAt}, extra...)
+	if err := s.Scan(dest...); err != nil {
+		return err
+	}
+
+	if len(data) > 0 {
+		row.Data = json.RawMessage(data)
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package core_service
+
+import (
+	"backend/internal/db"
+	"backend/internal/lexorank"
+	"backend/internal/rowquery"
+	"backend/internal/runtime_errors"
+	"backend/payloads/request"
+	"backend/payloads/response"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// rowsCursor marks the last row of a page by its Rank and ID. Score is set
+// on fuzzy searches, whose pages are ordered by it first, and kept as text
+// so the comparison on the next page is exact. Pages with a custom sort
+// have no usable keyset and carry the Offset of the next page instead.
+type rowsCursor struct {
+	Rank   string `json:"r,omitempty"`
+	ID     int    `json:"i,omitempty"`
+	Score  string `json:"s,omitempty"`
+	Offset int    `json:"o,omitempty"`
+}
+
+func encodeCursor(c rowsCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*rowsCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, &runtime_errors.BadRequestError{Message: "Invalid cursor"}
+	}
+
+	var c rowsCursor
+	if err := json.Unmarshal(b, &c); err != nil || (c.Rank == "") == (c.Offset <= 0) {
+		return nil, &runtime_errors.BadRequestError{Message: "Invalid cursor"}
+	}
+	if c.Rank != "" && lexorank.Validate(c.Rank) != nil {
+		return nil, &runtime_errors.BadRequestError{Message: "Invalid cursor"}
+	}
+	// The score is cast in SQL, so anything but a number would fail there
+	// instead of here.
+	if c.Score != "" && !isFiniteNumber(c.Score, 32) {
+		return nil, &runtime_errors.BadRequestError{Message: "Invalid cursor"}
+	}
+	return &c, nil
+}
+
+// decimalNumber matches the plain decimal numbers Postgres prints for
+// real values, and accepts back in casts.
+var decimalNumber = regexp.MustCompile(`^-?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?$`)
+
+// isFiniteNumber reports whether s is a decimal number that fits in a
+// float of the given bit size.
+func isFiniteNumber(s string, bitSize int) bool {
+	_, err := strconv.ParseFloat(s, bitSize)
+	return err == nil && decimalNumber.MatchString(s)
+}
+
+// rowsWhere selects the live rows of a file owned by userID that match the
+// query's filters.
+func rowsWhere(userID, fileID int, query request.RowsQuery) (whereClause, error) {
+	var where whereClause
+	where.add("csv_file_id = %s", fileID)
+	where.add("deleted_at IS NULL")
+	where.add("EXISTS (SELECT 1 FROM csv_table WHERE id = csv_rows.csv_file_id AND uploaded_by = %s AND deleted_at IS NULL)", userID)
+	for _, labelID := range query.LabelIDs {
+		where.add("EXISTS (SELECT 1 FROM csv_row_labels WHERE row_id = csv_rows.id AND label_id = %s)", labelID)
+	}
+
+	if query.Filter != "" {
+		filter, err := rowquery.Filter(query.Filter)
+		if err != nil {
+			return where, &runtime_errors.BadRequestError{Message: "Invalid filter: " + err.Error()}
+		}
+		where.add(filter.Text, filter.Args...)
+	}
+	return where, nil
+}
+
+// rowsOrder returns the ORDER BY list for query.Sort, binding its arguments
+// to where, or fallback when no sort was given. Custom sorts end with
+// rank and id so the order is total.
+func rowsOrder(where *whereClause, query request.RowsQuery, fallback string) (string, error) {
+	if query.Sort == "" {
+		return fallback, nil
+	}
+
+	order, err := rowquery.Sort(query.Sort)
+	if err != nil {
+		return "", &runtime_errors.BadRequestError{Message: "Invalid sort: " + err.Error()}
+	}
+	return where.expr(order.Text, order.Args...) + ", rank, id", nil
+}
+
+// Row search modes for RowsQuery.Mode.
+const (
+	searchSubstring = "substring"
+	searchFuzzy     = "fuzzy"
+)
+
+const defaultFuzzyThreshold = 0.3
+
+// GetRowsPageService returns one page of a file's rows ordered by
+// (rank, id), starting after query.Cursor. The page is read with a
+// keyset condition on idx_csv_rows_file_rank, so deep pages cost the
+// same as the first.
+//
+// With query.Search set, rows are narrowed on input_text using the trigram
+// index: a case-insensitive substring match, or in fuzzy mode a word
+// similarity of at least query.Threshold, best matches first.
+func GetRowsPageService(userID, fileID int, query request.RowsQuery) (*response.RowsPageResponse, error) {
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	if limit < 0 || limit > maxPageSize {
+		return nil, &runtime_errors.BadRequestError{
+			Message: fmt.Sprintf("limit must be between 1 and %d", maxPageSize),
+		}
+	}
+
+	mode := query.Mode
+	if mode == "" {
+		mode = searchSubstring
+	}
+	if mode != searchSubstring && mode != searchFuzzy {
+		return nil, &runtime_errors.BadRequestError{Message: "mode must be substring or fuzzy"}
+	}
+	fuzzy := query.Search != "" && mode == searchFuzzy
+
+	threshold := defaultFuzzyThreshold
+	if query.Threshold != nil {
+		threshold = *query.Threshold
+	}
+	if threshold <= 0 || threshold > 1 {
+		return nil, &runtime_errors.BadRequestError{Message: "threshold must be greater than 0 and at most 1"}
+	}
+
+	sorted := query.Sort != ""
+	var cursor *rowsCursor
+	if query.Cursor != "" {
+		var err error
+		if cursor, err = decodeCursor(query.Cursor); err != nil {
+			return nil, err
+		}
+		if sorted != (cursor.Offset > 0) || (!sorted && fuzzy != (cursor.Score != "")) {
+			return nil, &runtime_errors.BadRequestError{Message: "Cursor does not belong to this search"}
+		}
+	}
+
+	where, err := rowsWhere(userID, fileID, query)
+	if err != nil {
+		return nil, err
+	}
+	score, order := "NULL::real", "rank, id"
+	if query.Search != "" {
+		if fuzzy {
+			// <% uses the trigram index with the threshold set below.
+			where.add("%s <%% input_text", query.Search)
+			score = fmt.Sprintf("word_similarity($%d, input_text)", len(where.args))
+			order = "score DESC, rank, id"
+		} else {
+			where.add("input_text ILIKE %s", rowquery.LikePattern(query.Search))
+		}
+	}
+	// The sort's arguments are bound after the filters so the count below
+	// can reuse where.args as they stand.
+	filterArgs := len(where.args)
+	if order, err = rowsOrder(&where, query, order); err != nil {
+		return nil, err
+	}
+
+	page := response.RowsPageResponse{Rows: []response.GetRowsResponse{}}
+	err = withTx(func(tx *sql.Tx) error {
+		if err := checkOwnedFile(tx, fileID, userID); err != nil {
+			return err
+		}
+
+		if fuzzy {
+			_, err := tx.Exec(`SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)`, fmt.Sprint(threshold))
+			if err != nil {
+				return &runtime_errors.InternalServerError{Message: err.Error()}
+			}
+		}
+
+		if query.Count {
+			var total int64
+			err := tx.QueryRow("SELECT COUNT(*) FROM csv_rows WHERE "+where.String(), where.args[:filterArgs]...).Scan(&total)
+			if err != nil {
+				return &runtime_errors.InternalServerError{Message: err.Error()}
+			}
+			page.Total = &total
+		}
+
+		offset := 0
+		if cursor != nil {
+			if sorted {
+				offset = cursor.Offset
+			} else if fuzzy {
+				where.add("("+score+" < %s::real OR ("+score+" = %s::real AND (rank, id) > (%s, %s)))",
+					cursor.Score, cursor.Score, cursor.Rank, cursor.ID)
+			} else {
+				where.add("(rank, id) > (%s, %s)", cursor.Rank, cursor.ID)
+			}
+		}
+		// Numbering rows reads the whole file, so it is only done on request.
+		from, ordinal := "csv_rows", "NULL::bigint"
+		if query.Ordinals {
+			from, ordinal = where.expr(numberedRows, fileID), "ordinal"
+		}
+
+		rows, err := tx.Query(`
+			SELECT `+rowColumns+`, `+rowLabelsColumn+`, `+score+` AS score, `+score+`::text, `+ordinal+`
+			FROM `+from+`
+			WHERE `+where.String()+`
+			ORDER BY `+order+`
+			LIMIT `+where.expr("%s OFFSET %s", limit+1, offset),
+			where.args...,
+		)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		defer rows.Close()
+
+		var last rowsCursor
+		for rows.Next() {
+			var row response.GetRowsResponse
+			var rowScore sql.NullFloat64
+			var scoreText sql.NullString
+			var rowOrdinal sql.NullInt64
+			if err := scanRow(rows, &row, pq.Array(&row.Labels), &rowScore, &scoreText, &rowOrdinal); err != nil {
+				return &runtime_errors.InternalServerError{Message: err.Error()}
+			}
+
+			if len(page.Rows) == limit {
+				page.HasMore = true
+				break
+			}
+			if rowScore.Valid {
+				row.Score = &rowScore.Float64
+			}
+			row.Ordinal = rowOrdinal.Int64
+			page.Rows = append(page.Rows, row)
+			last = rowsCursor{Rank: row.Rank, ID: row.Id, Score: scoreText.String}
+		}
+		if err := rows.Err(); err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		if sorted {
+			last = rowsCursor{Offset: offset + len(page.Rows)}
+		}
+		if page.HasMore {
+			page.NextCursor = encodeCursor(last)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// GetRowRangeService returns the rows of a file whose 1-based ordinals in
+// (rank, id) order lie between from and to inclusive. A range past the
+// end of the file returns the rows that exist, possibly none.
+func GetRowRangeService(userID, fileID, from, to int) ([]response.GetRowsResponse, error) {
+	if from < 1 || to < from {
+		return nil, &runtime_errors.BadRequestError{Message: "from must be at least 1 and no greater than to"}
+	}
+	if to-from >= maxPageSize {
+		return nil, &runtime_errors.BadRequestError{
+			Message: fmt.Sprintf("A range can span at most %d rows", maxPageSize),
+		}
+	}
+
+	if err := checkOwnedFile(db.DB, fileID, userID); err != nil {
+		return nil, err
+	}
+
+	where, err := rowsWhere(userID, fileID, request.RowsQuery{})
+	if err != nil {
+		return nil, err
+	}
+	source := where.expr(numberedRows, fileID)
+	where.add("ordinal BETWEEN %s AND %s", from, to)
+
+	rows, err := db.DB.Query(`
+		SELECT `+rowColumns+`, `+rowLabelsColumn+`, ordinal FROM `+source+`
+		WHERE `+where.String()+`
+		ORDER BY ordinal`,
+		where.args...,
+	)
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	defer rows.Close()
+
+	result := []response.GetRowsResponse{}
+	for rows.Next() {
+		var row response.GetRowsResponse
+		if err := scanRow(rows, &row, pq.Array(&row.Labels), &row.Ordinal); err != nil {
+			return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,187 @@
+package core_service
+
+import (
+	"backend/internal/runtime_errors"
+	"backend/payloads/request"
+	"backend/payloads/response"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// maxSampleSize bounds both the rows drawn per stratum and the sample as a
+// whole, so a column with many distinct values cannot return the file.
+const maxSampleSize = 10000
+
+// stratifyByLabel stratifies a sample by the rows' labels rather than a
+// data column.
+const stratifyByLabel = "label"
+
+// SampleService draws a random sample of a file's rows matching the
+// query's filters. Rows are picked by hashing their id with the seed, so
+// the same seed gives the same sample for as long as the rows are
+// unchanged; without one a seed is chosen and returned. When Stratify is
+// set, up to Size rows are drawn from each value of that data column, or
+// from each label. A row with several labels can be drawn for each, and
+// rows without labels form a stratum of their own, named "".
+func SampleService(userID, fileID int, sample request.SampleRequest) (*response.SampleResponse, error) {
+	var result *response.SampleResponse
+	err := withTx(func(tx *sql.Tx) error {
+		var err error
+		result, err = drawSample(tx, userID, fileID, &sample)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// SaveSampleService draws a sample like SampleService and writes it out as
+// a new file, in the source file's order.
+func SaveSampleService(userID, fileID int, sample request.SampleRequest) (*response.SampleResponse, error) {
+	sample.FileName = strings.TrimSpace(sample.FileName)
+	if sample.FileName == "" {
+		return nil, &runtime_errors.BadRequestError{Message: "file_name is required"}
+	}
+	if err := checkFileNameLength(sample.FileName); err != nil {
+		return nil, err
+	}
+
+	var result *response.SampleResponse
+	err := withTx(func(tx *sql.Tx) error {
+		var err error
+		if result, err = drawSample(tx, userID, fileID, &sample); err != nil {
+			return err
+		}
+
+		// Strata may share rows; the new file holds each row once.
+		var rows []response.GetRowsResponse
+		seen := map[int]bool{}
+		for _, group := range result.Groups {
+			for _, row := range group.Rows {
+				if !seen[row.Id] {
+					seen[row.Id] = true
+					rows = append(rows, row)
+				}
+			}
+		}
+
+		newFileID, err := copyRowsToNewFile(tx, userID, fileID, sample.FileName, rows)
+		if err != nil {
+			return err
+		}
+		result.FileID = &newFileID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func drawSample(tx *sql.Tx, userID, fileID int, sample *request.SampleRequest) (*response.SampleResponse, error) {
+	if sample.Size < 1 || sample.Size > maxSampleSize {
+		return nil, &runtime_errors.BadRequestError{
+			Message: fmt.Sprintf("size must be between 1 and %d", maxSampleSize),
+		}
+	}
+	if sample.Seed == "" {
+		sample.Seed = strconv.FormatInt(rand.Int63(), 36)
+	}
+
+	var id int64
+	err := tx.QueryRow(`
+		SELECT id FROM csv_table
+		WHERE id = $1 AND uploaded_by = $2 AND deleted_at IS NULL`,
+		fileID, userID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, fileAccessError(tx, fileID, userID)
+	}
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	where, err := rowsWhere(userID, fileID, request.RowsQuery{LabelIDs: sample.LabelIDs, Filter: sample.Filter})
+	if err != nil {
+		return nil, err
+	}
+	draw := where.expr("md5(%s || ':' || id::text)", sample.Seed)
+
+	var stratum, from string
+	switch sample.Stratify {
+	case "":
+		stratum, from = "NULL::text", "csv_rows"
+	case stratifyByLabel:
+		stratum = "COALESCE(s.name, '')"
+		from = `csv_rows LEFT JOIN LATERAL (
+			SELECT l.name FROM csv_row_labels rl JOIN csv_labels l ON l.id = rl.label_id
+			WHERE rl.row_id = csv_rows.id) s ON true`
+	default:
+		stratum, from = where.expr("COALESCE(data->>%s::text, '')", sample.Stratify), "csv_rows"
+	}
+
+	rows, err := tx.Query(`
+		SELECT `+rowColumns+`, labels, stratum FROM (
+			SELECT `+rowColumns+`, `+rowLabelsColumn+` AS labels, `+stratum+` AS stratum,
+				row_number() OVER (PARTITION BY `+stratum+` ORDER BY `+draw+`, id) AS n
+			FROM `+from+`
+			WHERE `+where.String()+`
+		) drawn
+		WHERE n <= `+where.expr("%s", sample.Size)+`
+		ORDER BY stratum, rank, id
+		LIMIT `+where.expr("%s", maxSampleSize+1),
+		where.args...,
+	)
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	defer rows.Close()
+
+	result := response.SampleResponse{Seed: sample.Seed, Groups: []response.SampleGroup{}}
+	drawn := 0
+	for rows.Next() {
+		drawn++
+		if drawn > maxSampleSize {
+			return nil, &runtime_errors.BadRequestError{
+				Message: fmt.Sprintf("The sample would have more than %d rows; lower size or stratify by a column with fewer values", maxSampleSize),
+			}
+		}
+
+		var row response.GetRowsResponse
+		var value sql.NullString
+		if err := scanRow(rows, &row, pq.Array(&row.Labels), &value); err != nil {
+			return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		last := len(result.Groups) - 1
+		if last < 0 || !sameStratum(result.Groups[last].Stratum, value) {
+			group := response.SampleGroup{Rows: []response.GetRowsResponse{}}
+			if value.Valid {
+				group.Stratum = &value.String
+			}
+			result.Groups = append(result.Groups, group)
+			last++
+		}
+		result.Groups[last].Rows = append(result.Groups[last].Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return &result, nil
+}
+
+func sameStratum(stratum *string, value sql.NullString) bool {
+	if stratum == nil {
+		return !value.Valid
+	}
+	return value.Valid && *stratum == value.String
+}
@@ -0,0 +1,108 @@
+package core_service
+
+import (
+	"backend/internal/db"
+	"backend/internal/runtime_errors"
+	"backend/payloads/request"
+	"backend/payloads/response"
+	"fmt"
+	"html"
+	"strings"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// searchConfig is the text search configuration the search_vector column
+// is built with; queries must use the same one.
+const searchConfig = "english"
+
+// ts_headline marks matches with these private-use characters, which are
+// first removed from the row text, so the snippet can be HTML-escaped and
+// only then given its <mark> tags.
+const (
+	markStart = "\uE000"
+	markStop  = "\uE001"
+)
+
+// SearchService runs a full-text search over the live rows of userID's
+// files, best matches first. Query uses web search syntax: quoted phrases,
+// OR, and -word to exclude.
+func SearchService(userID int, search request.SearchQuery) ([]response.SearchResult, error) {
+	search.Query = strings.TrimSpace(search.Query)
+	if search.Query == "" {
+		return nil, &runtime_errors.BadRequestError{Message: "Search query cannot be empty"}
+	}
+
+	limit := search.Limit
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+	if limit < 0 || limit > maxSearchLimit {
+		return nil, &runtime_errors.BadRequestError{
+			Message: fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit),
+		}
+	}
+	if search.Offset < 0 {
+		return nil, &runtime_errors.BadRequestError{Message: "offset cannot be negative"}
+	}
+	if search.FileID != 0 {
+		if err := checkOwnedFile(db.DB, search.FileID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	var where whereClause
+	where.add("r.search_vector @@ websearch_to_tsquery('"+searchConfig+"', %s)", search.Query)
+	where.add("r.deleted_at IS NULL")
+	where.add("f.uploaded_by = %s", userID)
+	where.add("f.deleted_at IS NULL")
+	if search.FileID != 0 {
+		where.add("f.id = %s", search.FileID)
+	}
+	// The search text is the first argument.
+	query := fmt.Sprintf("websearch_to_tsquery('%s', $1)", searchConfig)
+
+	rows, err := db.DB.Query(`
+		SELECT f.id, f.file_name, r.id, r.position,
+			ts_headline('`+searchConfig+`',
+				translate(csv_row_search_text(r.input_text, r.data), '`+markStart+markStop+`', ''), `+query+`,
+				'StartSel="`+markStart+`", StopSel="`+markStop+`", MaxFragments=2, FragmentDelimiter=" … "'),
+			ts_rank_cd(r.search_vector, `+query+`) AS score
+		FROM csv_rows r
+		JOIN csv_table f ON f.id = r.csv_file_id
+		WHERE `+where.String()+`
+		ORDER BY score DESC, f.id, r.rank, r.id
+		LIMIT `+where.expr("%s OFFSET %s", limit, search.Offset),
+		where.args...,
+	)
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	defer rows.Close()
+
+	results := []response.SearchResult{}
+	for rows.Next() {
+		var result response.SearchResult
+		err := rows.Scan(&result.FileID, &result.FileName, &result.RowID, &result.Position, &result.Snippet, &result.Rank)
+		if err != nil {
+			return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		result.Snippet = markSnippet(result.Snippet)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return results, nil
+}
+
+// markSnippet escapes a ts_headline snippet for HTML and turns its match
+// markers into <mark> tags.
+func markSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	return strings.NewReplacer(markStart, "<mark>", markStop, "</mark>").Replace(snippet)
+}
@@ -0,0 +1,360 @@
+package core_service
+
+import (
+	"archive/zip"
+	"backend/internal/db"
+	"backend/internal/runtime_errors"
+	"backend/payloads/request"
+	"backend/payloads/response"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// Split outputs for SplitRequest.Output.
+const (
+	splitToFiles = "files"
+	splitToZip   = "zip"
+)
+
+// SplitExport holds a split's partitions for WriteSplitZip, along with the
+// source file's column names in upload order.
+type SplitExport struct {
+	Columns    []string
+	Partitions [][]response.GetRowsResponse
+}
+
+// SplitService deals a file's rows into named partitions by ratio. Rows
+// are shuffled by hashing their id with the seed, within each stratum when
+// Stratify is set, so the same request splits the same rows the same way.
+// Stratifying by "label" groups rows by their full set of labels, so no
+// row lands in two partitions. With the files output each partition is
+// saved as a new file; otherwise the partitions' rows are returned for the
+// caller to export. Either way the split is recorded in csv_splits.
+func SplitService(userID, fileID int, split request.SplitRequest) (*response.SplitResponse, *SplitExport, error) {
+	if split.Output == "" {
+		split.Output = splitToFiles
+	}
+	if split.Output != splitToFiles && split.Output != splitToZip {
+		return nil, nil, &runtime_errors.BadRequestError{Message: "output must be files or zip"}
+	}
+	if err := checkSplitPartitions(split.Partitions); err != nil {
+		return nil, nil, err
+	}
+	if split.Seed == "" {
+		split.Seed = strconv.FormatInt(rand.Int63(), 36)
+	}
+
+	result := response.SplitResponse{SourceFileID: fileID, Seed: split.Seed}
+	var export SplitExport
+	err := withTx(func(tx *sql.Tx) error {
+		var fileName string
+		var columns pq.StringArray
+		err := tx.QueryRow(`
+			SELECT file_name, column_names FROM csv_table
+			WHERE id = $1 AND uploaded_by = $2 AND deleted_at IS NULL`,
+			fileID, userID,
+		).Scan(&fileName, &columns)
+		if err == sql.ErrNoRows {
+			return fileAccessError(tx, fileID, userID)
+		}
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		export.Columns = columns
+		if export.Partitions, err = dealSplit(tx, userID, fileID, split); err != nil {
+			return err
+		}
+
+		for i, partition := range split.Partitions {
+			out := response.SplitPartition{Name: partition.Name, Ratio: partition.Ratio, Rows: len(export.Partitions[i])}
+			if split.Output == splitToFiles {
+				newFileID, err := copyRowsToNewFile(tx, userID, fileID, partitionFileName(fileName, partition.Name), export.Partitions[i])
+				if err != nil {
+					return err
+				}
+				out.FileID = &newFileID
+			}
+			result.Partitions = append(result.Partitions, out)
+		}
+
+		params, err := json.Marshal(split)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		outcome, err := json.Marshal(result.Partitions)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		err = tx.QueryRow(`
+			INSERT INTO csv_splits (csv_file_id, created_by, params, partitions)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, created_at`,
+			fileID, userID, string(params), string(outcome),
+		).Scan(&result.ID, &result.CreatedAt)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		result.Params = params
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &result, &export, nil
+}
+
+// maxPartitionNameLength leaves most of a saved partition's file name to
+// the source file's name.
+const maxPartitionNameLength = 50
+
+// partitionFileName names the file a partition is saved as, shortening the
+// source file's name so the result fits in csv_table.
+func partitionFileName(fileName, partitionName string) string {
+	suffix := " - " + partitionName
+	if room := maxFileNameLength - utf8.RuneCountInString(suffix); utf8.RuneCountInString(fileName) > room {
+		fileName = string([]rune(fileName)[:room])
+	}
+	return fileName + suffix
+}
+
+func checkSplitPartitions(partitions []request.SplitPartition) error {
+	if len(partitions) < 2 {
+		return &runtime_errors.BadRequestError{Message: "At least two partitions are required"}
+	}
+
+	names := map[string]bool{}
+	total := 0.0
+	for _, partition := range partitions {
+		name := strings.TrimSpace(partition.Name)
+		if name == "" || name != partition.Name || strings.ContainsAny(name, `/\`) {
+			return &runtime_errors.BadRequestError{Message: fmt.Sprintf("Invalid partition name %q", partition.Name)}
+		}
+		if utf8.RuneCountInString(name) > maxPartitionNameLength {
+			return &runtime_errors.BadRequestError{
+				Message: fmt.Sprintf("Partition names can be at most %d characters", maxPartitionNameLength),
+			}
+		}
+		if names[name] {
+			return &runtime_errors.BadRequestError{Message: fmt.Sprintf("Duplicate partition name %q", name)}
+		}
+		names[name] = true
+
+		if partition.Ratio <= 0 {
+			return &runtime_errors.BadRequestError{Message: "Partition ratios must be positive"}
+		}
+		total += partition.Ratio
+	}
+	if math.Abs(total-1) > 1e-9 {
+		return &runtime_errors.BadRequestError{Message: "Partition ratios must add up to 1"}
+	}
+
+	return nil
+}
+
+// dealSplit reads the rows to split in shuffled order, stratum by stratum,
+// and deals each stratum out by the partition ratios. Partitions come
+// back in file order.
+func dealSplit(tx *sql.Tx, userID, fileID int, split request.SplitRequest) ([][]response.GetRowsResponse, error) {
+	where, err := rowsWhere(userID, fileID, request.RowsQuery{LabelIDs: split.LabelIDs, Filter: split.Filter})
+	if err != nil {
+		return nil, err
+	}
+	draw := where.expr("md5(%s || ':' || id::text)", split.Seed)
+
+	stratum := "''"
+	switch split.Stratify {
+	case "":
+	case stratifyByLabel:
+		stratum = `(SELECT COALESCE(string_agg(l.name, ',' ORDER BY l.name), '')
+			FROM csv_row_labels rl JOIN csv_labels l ON l.id = rl.label_id
+			WHERE rl.row_id = csv_rows.id)`
+	default:
+		stratum = where.expr("COALESCE(data->>%s::text, '')", split.Stratify)
+	}
+
+	rows, err := tx.Query(`
+		SELECT `+rowColumns+`, `+stratum+` AS stratum FROM csv_rows
+		WHERE `+where.String()+`
+		ORDER BY stratum, `+draw+`, id`,
+		where.args...,
+	)
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	defer rows.Close()
+
+	partitions := make([][]response.GetRowsResponse, len(split.Partitions))
+	var stratumRows []response.GetRowsResponse
+	deal := func() {
+		start := 0
+		cumulative := 0.0
+		for i, partition := range split.Partitions {
+			cumulative += partition.Ratio
+			end := int(math.Round(cumulative * float64(len(stratumRows))))
+			if i == len(split.Partitions)-1 {
+				end = len(stratumRows)
+			}
+			partitions[i] = append(partitions[i], stratumRows[start:end]...)
+			start = end
+		}
+		stratumRows = nil
+	}
+
+	current := ""
+	for rows.Next() {
+		var row response.GetRowsResponse
+		var value string
+		if err := scanRow(rows, &row, &value); err != nil {
+			return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		if value != current && len(stratumRows) > 0 {
+			deal()
+		}
+		current = value
+		stratumRows = append(stratumRows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	deal()
+
+	for _, partition := range partitions {
+		sort.Slice(partition, func(i, j int) bool {
+			a, b := partition[i], partition[j]
+			return a.Rank < b.Rank || (a.Rank == b.Rank && a.Id < b.Id)
+		})
+	}
+	return partitions, nil
+}
+
+// GetSplitsService lists the splits recorded for a file, newest first.
+func GetSplitsService(userID, fileID int) ([]response.SplitResponse, error) {
+	if err := checkOwnedFile(db.DB, fileID, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.DB.Query(`
+		SELECT s.id, s.params, s.partitions, s.created_at FROM csv_splits s
+		JOIN csv_table f ON f.id = s.csv_file_id
+		WHERE s.csv_file_id = $1 AND f.uploaded_by = $2 AND f.deleted_at IS NULL
+		ORDER BY s.id DESC`,
+		fileID, userID,
+	)
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	defer rows.Close()
+
+	splits := []response.SplitResponse{}
+	for rows.Next() {
+		split := response.SplitResponse{SourceFileID: fileID}
+		var params, partitions []byte
+		if err := rows.Scan(&split.ID, &params, &partitions, &split.CreatedAt); err != nil {
+			return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		split.Params = params
+		if err := json.Unmarshal(partitions, &split.Partitions); err != nil {
+			return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		var recorded request.SplitRequest
+		if err := json.Unmarshal(params, &recorded); err == nil {
+			split.Seed = recorded.Seed
+		}
+		splits = append(splits, split)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return splits, nil
+}
+
+// WriteSplitZip writes one CSV per partition into a zip archive. Each CSV
+// has the source file's header, so it can be uploaded again as it is.
+func WriteSplitZip(w io.Writer, split *response.SplitResponse, export *SplitExport) error {
+	archive := zip.NewWriter(w)
+
+	for i, partition := range split.Partitions {
+		file, err := archive.Create(partition.Name + ".csv")
+		if err != nil {
+			return err
+		}
+		if err := writeRowsCSV(file, export.Columns, export.Partitions[i]); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// writeRowsCSV writes rows as a CSV with the given columns in order,
+// followed by any other data columns the rows carry, sorted by name. Files
+// without stored column names get just the sorted data columns. The upload
+// takes the third column as the row text, so that column is written from
+// the row's current text rather than its data.
+func writeRowsCSV(w io.Writer, columns []string, rows []response.GetRowsResponse) error {
+	values := make([]map[string]any, len(rows))
+	known := make(map[string]bool, len(columns))
+	for _, name := range columns {
+		known[name] = true
+	}
+	var extra []string
+	for i, row := range rows {
+		if len(row.Data) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(row.Data, &values[i]); err != nil {
+			return err
+		}
+		for name := range values[i] {
+			if !known[name] {
+				known[name] = true
+				extra = append(extra, name)
+			}
+		}
+	}
+	sort.Strings(extra)
+	header := append(append([]string{}, columns...), extra...)
+
+	out := csv.NewWriter(w)
+	if err := out.Write(header); err != nil {
+		return err
+	}
+	for i, row := range rows {
+		record := make([]string, 0, len(header))
+		for _, name := range header {
+			switch value := values[i][name].(type) {
+			case nil:
+				record = append(record, "")
+			case string:
+				record = append(record, value)
+			default:
+				encoded, _ := json.Marshal(value)
+				record = append(record, string(encoded))
+			}
+		}
+		if len(columns) > 2 {
+			record[2] = row.InputText
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
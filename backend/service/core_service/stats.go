@@ -0,0 +1,237 @@
+package core_service
+
+import (
+	"backend/internal/db"
+	"backend/internal/runtime_errors"
+	"backend/payloads/response"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	statsTopTokens        = 20
+	statsHistogramBuckets = 10
+)
+
+// GetFileStatsService returns a data-quality report for a file's live rows.
+// Reports are cached in csv_file_stats, which the csv_rows triggers of
+// migration 014 clear whenever a row of the file changes.
+func GetFileStatsService(userID, fileID int) (*response.FileStatsResponse, error) {
+	var cached []byte
+	var computedAt sql.NullString
+	err := db.DB.QueryRow(`
+		SELECT s.stats, s.computed_at FROM csv_table f
+		LEFT JOIN csv_file_stats s ON s.csv_file_id = f.id
+		WHERE f.id = $1 AND f.uploaded_by = $2 AND f.deleted_at IS NULL`,
+		fileID, userID,
+	).Scan(&cached, &computedAt)
+	if err == sql.ErrNoRows {
+		return nil, fileAccessError(db.DB, fileID, userID)
+	}
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	if cached != nil {
+		var stats response.FileStatsResponse
+		if err := json.Unmarshal(cached, &stats); err != nil {
+			return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		stats.Cached = true
+		stats.ComputedAt = computedAt.String
+		return &stats, nil
+	}
+
+	var stats *response.FileStatsResponse
+	err = withTx(func(tx *sql.Tx) error {
+		// A share lock keeps row mutations, which lock the file for update,
+		// out until the report is stored, so it is never stale.
+		var id int64
+		err := tx.QueryRow(`
+			SELECT id FROM csv_table
+			WHERE id = $1 AND uploaded_by = $2 AND deleted_at IS NULL
+			FOR SHARE`, fileID, userID).Scan(&id)
+		if err == sql.ErrNoRows {
+			return fileAccessError(tx, fileID, userID)
+		}
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		if stats, err = computeFileStats(tx, fileID); err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(stats)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		err = tx.QueryRow(`
+			INSERT INTO csv_file_stats (csv_file_id, stats)
+			VALUES ($1, $2)
+			ON CONFLICT (csv_file_id) DO UPDATE SET stats = EXCLUDED.stats, computed_at = now()
+			RETURNING computed_at`,
+			fileID, string(encoded),
+		).Scan(&stats.ComputedAt)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func computeFileStats(tx *sql.Tx, fileID int) (*response.FileStatsResponse, error) {
+	stats := response.FileStatsResponse{
+		TopTokens: []response.TokenCount{},
+		Columns:   []response.ColumnStats{},
+	}
+
+	length := &stats.Length
+	err := tx.QueryRow(`
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE input_text ~ '^\s*$'),
+			COALESCE(MIN(len), 0), COALESCE(MAX(len), 0), COALESCE(AVG(len), 0),
+			COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY len), 0),
+			COALESCE(percentile_cont(0.9) WITHIN GROUP (ORDER BY len), 0),
+			COALESCE(percentile_cont(0.99) WITHIN GROUP (ORDER BY len), 0)
+		FROM (
+			SELECT input_text, char_length(input_text) AS len FROM csv_rows
+			WHERE csv_file_id = $1 AND deleted_at IS NULL
+		) r`,
+		fileID,
+	).Scan(&stats.RowCount, &stats.EmptyRows,
+		&length.Min, &length.Max, &length.Mean, &length.Median, &length.P90, &length.P99)
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	err = tx.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(n - 1), 0) FROM (
+			SELECT COUNT(*) AS n FROM csv_rows
+			WHERE csv_file_id = $1 AND deleted_at IS NULL
+			GROUP BY input_text
+			HAVING COUNT(*) > 1
+		) d`,
+		fileID,
+	).Scan(&stats.DuplicateGroups, &stats.DuplicateRows)
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	if err := scanRowTexts(tx, fileID, &stats); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`
+		SELECT d.key,
+			COUNT(*) FILTER (WHERE d.value IS NOT NULL AND d.value <> ''),
+			COUNT(DISTINCT d.value)
+		FROM csv_rows r, jsonb_each_text(r.data) d
+		WHERE r.csv_file_id = $1 AND r.deleted_at IS NULL
+		GROUP BY d.key
+		ORDER BY d.key`,
+		fileID,
+	)
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var column response.ColumnStats
+		if err := rows.Scan(&column.Name, &column.NonEmpty, &column.Distinct); err != nil {
+			return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		if stats.RowCount > 0 {
+			column.NullRate = 1 - float64(column.NonEmpty)/float64(stats.RowCount)
+		}
+		stats.Columns = append(stats.Columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return &stats, nil
+}
+
+// scanRowTexts reads every row's text once to build the length histogram,
+// the token counts and the encoding checks, which are awkward in SQL.
+func scanRowTexts(tx *sql.Tx, fileID int, stats *response.FileStatsResponse) error {
+	width := stats.Length.Max/statsHistogramBuckets + 1
+	histogram := make([]response.LengthBucket, statsHistogramBuckets)
+	for i := range histogram {
+		histogram[i] = response.LengthBucket{From: i * width, To: (i+1)*width - 1}
+	}
+
+	rows, err := tx.Query(`
+		SELECT input_text FROM csv_rows
+		WHERE csv_file_id = $1 AND deleted_at IS NULL`,
+		fileID,
+	)
+	if err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	defer rows.Close()
+
+	tokens := map[string]int64{}
+	for rows.Next() {
+		var text string
+		if err := rows.Scan(&text); err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		bucket := utf8.RuneCountInString(text) / width
+		if bucket >= len(histogram) {
+			bucket = len(histogram) - 1
+		}
+		histogram[bucket].Rows++
+
+		// Uploads replace bytes that were not UTF-8 with U+FFFD, so those
+		// rows are the ones holding a replacement character.
+		if strings.ContainsRune(text, utf8.RuneError) {
+			stats.InvalidUTF8Rows++
+		}
+		if strings.IndexFunc(text, isControl) >= 0 {
+			stats.ControlCharRows++
+		}
+
+		for _, token := range strings.FieldsFunc(strings.ToLower(text), isTokenSeparator) {
+			tokens[token]++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	stats.Length.Histogram = histogram
+	for token, count := range tokens {
+		stats.TopTokens = append(stats.TopTokens, response.TokenCount{Token: token, Count: count})
+	}
+	sort.Slice(stats.TopTokens, func(i, j int) bool {
+		a, b := stats.TopTokens[i], stats.TopTokens[j]
+		return a.Count > b.Count || (a.Count == b.Count && a.Token < b.Token)
+	})
+	if len(stats.TopTokens) > statsTopTokens {
+		stats.TopTokens = stats.TopTokens[:statsTopTokens]
+	}
+
+	return nil
+}
+
+// isControl reports control characters other than tab and line breaks.
+func isControl(r rune) bool {
+	return unicode.IsControl(r) && r != '\t' && r != '\n' && r != '\r'
+}
+
+func isTokenSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
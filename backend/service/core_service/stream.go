@@ -0,0 +1,89 @@
+package core_service
+
+import (
+	"backend/internal/db"
+	"backend/internal/runtime_errors"
+	"backend/payloads/request"
+	"backend/payloads/response"
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// queryRows runs the full rows listing for query, in file order unless
+// query.Sort says otherwise, with each row's labels and ordinal after
+// rowColumns. The ordinal is NULL unless query.Ordinals is set. The query
+// is cancelled with ctx.
+func queryRows(ctx context.Context, userID, fileID int, query request.RowsQuery) (*sql.Rows, error) {
+	where, err := rowsWhere(userID, fileID, query)
+	if err != nil {
+		return nil, err
+	}
+	order, err := rowsOrder(&where, query, "rank, id")
+	if err != nil {
+		return nil, err
+	}
+
+	from, ordinal := "csv_rows", "NULL::bigint"
+	if query.Ordinals {
+		from, ordinal = where.expr(numberedRows, fileID), "ordinal"
+	}
+
+	rows, err := db.DB.QueryContext(ctx, `
+		SELECT `+rowColumns+`, `+rowLabelsColumn+`, `+ordinal+` FROM `+from+`
+		WHERE `+where.String()+`
+		ORDER BY `+order,
+		where.args...,
+	)
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return rows, nil
+}
+
+// StreamRowsService passes a file's rows to emit one at a time as they are
+// read from the database, so memory use does not grow with the file. It
+// stops with ctx's error when ctx is cancelled, and with emit's error when
+// emit fails. Nothing is emitted when the file is not the user's.
+func StreamRowsService(ctx context.Context, userID, fileID int, query request.RowsQuery, emit func(row *response.GetRowsResponse) error) error {
+	var id int64
+	err := db.DB.QueryRowContext(ctx, `
+		SELECT id FROM csv_table
+		WHERE id = $1 AND uploaded_by = $2 AND deleted_at IS NULL`,
+		fileID, userID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fileAccessError(db.DB, fileID, userID)
+	}
+	if err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	rows, err := queryRows(ctx, userID, fileID, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row response.GetRowsResponse
+		var ordinal sql.NullInt64
+		if err := scanRow(rows, &row, pq.Array(&row.Labels), &ordinal); err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		row.Ordinal = ordinal.Int64
+		if err := emit(&row); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := rows.Err(); err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return nil
+}
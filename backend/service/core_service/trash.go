@@ -0,0 +1,299 @@
+package core_service
+
+import (
+	"backend/internal/db"
+	"backend/internal/runtime_errors"
+	"backend/payloads/request"
+	"backend/payloads/response"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TrashFileService moves a file to the trash. Its rows stay untouched and
+// come back with it on restore.
+func TrashFileService(userID, fileID int) error {
+	return withTx(func(tx *sql.Tx) error {
+		if err := beginOperation(tx, userID, fileID, "trash_file"); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(`UPDATE csv_table SET deleted_at = NOW() WHERE id = $1`, fileID)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		return nil
+	})
+}
+
+// trashCursor marks the last entry of a trash page. DeletedAt keeps the
+// timestamp as scanned so the next page compares it exactly.
+type trashCursor struct {
+	DeletedAt string `json:"d"`
+	ID        int    `json:"i"`
+}
+
+func encodeTrashCursor(c trashCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeTrashCursor(s string) (*trashCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, &runtime_errors.BadRequestError{Message: "Invalid cursor"}
+	}
+
+	var c trashCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID <= 0 {
+		return nil, &runtime_errors.BadRequestError{Message: "Invalid cursor"}
+	}
+	if _, err := time.Parse(time.RFC3339Nano, c.DeletedAt); err != nil {
+		return nil, &runtime_errors.BadRequestError{Message: "Invalid cursor"}
+	}
+	return &c, nil
+}
+
+// GetTrashService lists the user's trashed files, and trashed rows of files
+// that are not themselves in the trash, newest first. Each list is paged
+// on its own with a keyset on (deleted_at, id).
+func GetTrashService(userID int, query request.TrashQuery) (*response.TrashResponse, error) {
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	if limit < 0 || limit > maxPageSize {
+		return nil, &runtime_errors.BadRequestError{
+			Message: fmt.Sprintf("limit must be between 1 and %d", maxPageSize),
+		}
+	}
+
+	trash := response.TrashResponse{
+		Files: []response.TrashedFile{},
+		Rows:  []response.TrashedRow{},
+	}
+
+	var files whereClause
+	files.add("uploaded_by = %s", userID)
+	files.add("deleted_at IS NOT NULL")
+	if query.FilesCursor != "" {
+		cursor, err := decodeTrashCursor(query.FilesCursor)
+		if err != nil {
+			return nil, err
+		}
+		files.add("(deleted_at, id) < (%s::timestamptz, %s)", cursor.DeletedAt, cursor.ID)
+	}
+
+	fileRows, err := db.DB.Query(`
+		SELECT id, file_name, deleted_at FROM csv_table
+		WHERE `+files.String()+`
+		ORDER BY deleted_at DESC, id DESC
+		LIMIT `+files.expr("%s", limit+1),
+		files.args...,
+	)
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	defer fileRows.Close()
+
+	for fileRows.Next() {
+		var file response.TrashedFile
+		if err := fileRows.Scan(&file.ID, &file.Filename, &file.DeletedAt); err != nil {
+			return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		if len(trash.Files) == limit {
+			last := trash.Files[limit-1]
+			trash.NextFilesCursor = encodeTrashCursor(trashCursor{DeletedAt: last.DeletedAt, ID: last.ID})
+			break
+		}
+		trash.Files = append(trash.Files, file)
+	}
+	if err := fileRows.Err(); err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	var rows whereClause
+	rows.add("f.uploaded_by = %s", userID)
+	rows.add("f.deleted_at IS NULL")
+	rows.add("r.deleted_at IS NOT NULL")
+	if query.RowsCursor != "" {
+		cursor, err := decodeTrashCursor(query.RowsCursor)
+		if err != nil {
+			return nil, err
+		}
+		rows.add("(r.deleted_at, r.id) < (%s::timestamptz, %s)", cursor.DeletedAt, cursor.ID)
+	}
+
+	rowRows, err := db.DB.Query(`
+		SELECT r.id, r.csv_file_id, r.input_text, r.deleted_at FROM csv_rows r
+		JOIN csv_table f ON f.id = r.csv_file_id
+		WHERE `+rows.String()+`
+		ORDER BY r.deleted_at DESC, r.id DESC
+		LIMIT `+rows.expr("%s", limit+1),
+		rows.args...,
+	)
+	if err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	defer rowRows.Close()
+
+	for rowRows.Next() {
+		var row response.TrashedRow
+		if err := rowRows.Scan(&row.ID, &row.FileID, &row.InputText, &row.DeletedAt); err != nil {
+			return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		if len(trash.Rows) == limit {
+			last := trash.Rows[limit-1]
+			trash.NextRowsCursor = encodeTrashCursor(trashCursor{DeletedAt: last.DeletedAt, ID: last.ID})
+			break
+		}
+		trash.Rows = append(trash.Rows, row)
+	}
+	if err := rowRows.Err(); err != nil {
+		return nil, &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return &trash, nil
+}
+
+// RestoreTrashService takes the given files and rows back out of the trash.
+// Restored rows reappear in the slot they were deleted from. Rows of a file
+// that stays in the trash are left there, and not counted; restore the
+// file in the same request to bring them back with it.
+func RestoreTrashService(userID int, items request.TrashRequest) (*response.TrashCountResponse, error) {
+	if len(items.FileIDs) == 0 && len(items.RowIDs) == 0 {
+		return nil, &runtime_errors.BadRequestError{Message: "file_ids or row_ids are required"}
+	}
+
+	var counts response.TrashCountResponse
+	err := withTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`
+			UPDATE csv_table SET deleted_at = NULL
+			WHERE id = ANY($1) AND uploaded_by = $2 AND deleted_at IS NOT NULL`,
+			pq.Array(items.FileIDs), userID)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		if counts.Files, err = result.RowsAffected(); err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		result, err = tx.Exec(`
+			UPDATE csv_rows r SET deleted_at = NULL
+			FROM csv_table f
+			WHERE f.id = r.csv_file_id AND f.uploaded_by = $2 AND f.deleted_at IS NULL
+				AND r.id = ANY($1) AND r.deleted_at IS NOT NULL`,
+			pq.Array(items.RowIDs), userID)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		if counts.Rows, err = result.RowsAffected(); err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &counts, nil
+}
+
+// PurgeTrashService permanently deletes trashed files and rows. With no ids
+// it empties the user's whole trash. Purging a file removes all its rows
+// through the ON DELETE CASCADE on csv_rows.
+func PurgeTrashService(userID int, items request.TrashRequest) (*response.TrashCountResponse, error) {
+	all := len(items.FileIDs) == 0 && len(items.RowIDs) == 0
+
+	var counts response.TrashCountResponse
+	err := withTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`
+			DELETE FROM csv_rows r
+			USING csv_table f
+			WHERE f.id = r.csv_file_id AND f.uploaded_by = $2
+				AND r.deleted_at IS NOT NULL AND ($3 OR r.id = ANY($1))`,
+			pq.Array(items.RowIDs), userID, all)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		if counts.Rows, err = result.RowsAffected(); err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		result, err = tx.Exec(`
+			DELETE FROM csv_table
+			WHERE uploaded_by = $2 AND deleted_at IS NOT NULL AND ($3 OR id = ANY($1))`,
+			pq.Array(items.FileIDs), userID, all)
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		if counts.Files, err = result.RowsAffected(); err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &counts, nil
+}
+
+// PurgeExpiredTrash permanently deletes everything that has been in the
+// trash for longer than retention.
+func PurgeExpiredTrash(retention time.Duration) (*response.TrashCountResponse, error) {
+	var counts response.TrashCountResponse
+	err := withTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`
+			DELETE FROM csv_rows
+			WHERE deleted_at < NOW() - make_interval(secs => $1)`,
+			retention.Seconds())
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		if counts.Rows, err = result.RowsAffected(); err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		result, err = tx.Exec(`
+			DELETE FROM csv_table
+			WHERE deleted_at < NOW() - make_interval(secs => $1)`,
+			retention.Seconds())
+		if err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+		if counts.Files, err = result.RowsAffected(); err != nil {
+			return &runtime_errors.InternalServerError{Message: err.Error()}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &counts, nil
+}
+
+// StartTrashPurger purges expired trash once straight away and then every
+// interval, for the lifetime of the process.
+func StartTrashPurger(retention, interval time.Duration) {
+	go func() {
+		for {
+			counts, err := PurgeExpiredTrash(retention)
+			if err != nil {
+				fmt.Println("Error purging trash: " + err.Error())
+			} else if counts.Files > 0 || counts.Rows > 0 {
+				fmt.Printf("Purged %d files and %d rows from trash\n", counts.Files, counts.Rows)
+			}
+
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -0,0 +1,90 @@
+package core_service
+
+import (
+	"backend/internal/db"
+	"backend/internal/runtime_errors"
+	"database/sql"
+	"fmt"
+)
+
+// withTx runs fn inside a transaction, committing when fn returns nil and
+// rolling back otherwise. Errors from fn are returned untouched so callers
+// keep their runtime_errors type.
+func withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return &runtime_errors.InternalServerError{
+			Message: fmt.Sprintf("failed to begin transaction: %v", err),
+		}
+	}
+
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return &runtime_errors.InternalServerError{
+			Message: fmt.Sprintf("failed to commit transaction: %v", err),
+		}
+	}
+
+	return nil
+}
+
+// lockOwnedFile checks that fileID belongs to userID and takes a row lock on
+// the file so concurrent row mutations on the same file are serialized.
+func lockOwnedFile(tx *sql.Tx, fileID, userID int) error {
+	var id int64
+	err := tx.QueryRow(`
+		SELECT id FROM csv_table
+		WHERE id = $1 AND uploaded_by = $2 AND deleted_at IS NULL
+		FOR UPDATE`, fileID, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fileAccessError(tx, fileID, userID)
+	}
+	if err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return nil
+}
+
+// checkOwnedFile is lockOwnedFile without the lock, for reads.
+func checkOwnedFile(q rowQuerier, fileID, userID int) error {
+	var id int64
+	err := q.QueryRow(`
+		SELECT id FROM csv_table
+		WHERE id = $1 AND uploaded_by = $2 AND deleted_at IS NULL`, fileID, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fileAccessError(q, fileID, userID)
+	}
+	if err != nil {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+
+	return nil
+}
+
+// rowQuerier is a *sql.DB or *sql.Tx.
+type rowQuerier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// fileAccessError explains why an ownership check on fileID found nothing:
+// a NotFoundError when there is no such live file, and a ForbiddenError when
+// it belongs to someone other than userID.
+func fileAccessError(q rowQuerier, fileID, userID int) error {
+	var ownerID sql.NullInt64
+	err := q.QueryRow(`
+		SELECT uploaded_by FROM csv_table
+		WHERE id = $1 AND deleted_at IS NULL`, fileID).Scan(&ownerID)
+	if err != nil && err != sql.ErrNoRows {
+		return &runtime_errors.InternalServerError{Message: err.Error()}
+	}
+	if err == nil && ownerID.Int64 != int64(userID) {
+		return &runtime_errors.ForbiddenError{Message: "You do not have access to this file"}
+	}
+
+	return &runtime_errors.NotFoundError{Message: "File not found"}
+}
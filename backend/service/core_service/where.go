@@ -0,0 +1,36 @@
+package core_service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// whereClause collects AND-ed SQL conditions and their arguments. Each %s
+// in a condition is replaced with the next $n placeholder, so callers never
+// splice values into SQL.
+type whereClause struct {
+	conditions []string
+	args       []any
+}
+
+func (w *whereClause) add(condition string, args ...any) {
+	w.conditions = append(w.conditions, w.expr(condition, args...))
+}
+
+// expr binds args to the clause like add, but returns the expression for
+// use elsewhere in the query, such as in ORDER BY.
+func (w *whereClause) expr(expression string, args ...any) string {
+	placeholders := make([]any, len(args))
+	for i, arg := range args {
+		w.args = append(w.args, arg)
+		placeholders[i] = fmt.Sprintf("$%d", len(w.args))
+	}
+	return fmt.Sprintf(expression, placeholders...)
+}
+
+func (w *whereClause) String() string {
+	if len(w.conditions) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(w.conditions, " AND ")
+}
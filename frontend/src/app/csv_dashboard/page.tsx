@@ -47,8 +47,20 @@ interface CSVRow {
   id: number;
   position: number;
   input_text: string;
+  version: number;
 }
 
+// One page of GET /files/{id}/rows
+interface RowsPage {
+  rows: CSVRow[];
+  next_cursor?: string;
+  has_more: boolean;
+  total?: number;
+}
+
+// Rows fetched per request; the server allows up to 1000
+const ROWS_FETCH_SIZE = 1000;
+
 // Memoized row component to prevent unnecessary re-renders
 const CSVRowComponent = memo(({ 
   row, 
@@ -179,8 +191,10 @@ export default function FilesPage() {
   
   // CSV data display state
   const [currentFile, setCurrentFile] = useState<FileItem | null>(null);
-  const [allCsvRows, setAllCsvRows] = useState<CSVRow[]>([]); // All rows
+  const [allCsvRows, setAllCsvRows] = useState<CSVRow[]>([]); // Rows loaded so far, in file order
   const [totalRows, setTotalRows] = useState(0);
+  const [nextCursor, setNextCursor] = useState<string | null>(null); // Where the next server page starts
+  const [loadingMore, setLoadingMore] = useState(false);
   const [currentPage, setCurrentPage] = useState(1);
   const [rowsPerPage, setRowsPerPage] = useState(100);
   const [insertDialogOpen, setInsertDialogOpen] = useState(false);
@@ -265,38 +279,78 @@ export default function FilesPage() {
     }
   }, [selectedFile, filename, token, fetchFiles]);
 
-  // Fetch CSV rows for display
+  // Fetch one server page of rows. Large files are never loaded whole:
+  // pages are fetched as the table needs them, following next_cursor.
+  const fetchRowsPage = useCallback(async (file: FileItem, cursor: string | null, withCount: boolean) => {
+    const params = new URLSearchParams({ limit: String(ROWS_FETCH_SIZE) });
+    if (cursor) params.set("cursor", cursor);
+    if (withCount) params.set("count", "true");
+
+    const res = await fetch(`http://localhost:8080/files/${file.id}/rows?${params}`, {
+      headers: {
+        Authorization: "Bearer " + token,
+      },
+    });
+    const data = await res.json();
+    if (!data.status) {
+      throw new Error(data.message);
+    }
+    return data.body as RowsPage;
+  }, [token]);
+
+  // Fetch CSV rows for display: enough to fill the current page when
+  // maintaining it, and the first page otherwise
   const fetchCSVRows = useCallback(async (file: FileItem, maintainPage = false) => {
     if (!token) return;
     setLoading(true);
     try {
-      const res = await fetch(`http://localhost:8080/files/${file.id}`, {
-        headers: {
-          Authorization: "Bearer " + token,
-        },
-      });
-      const data = await res.json();
+      const needed = maintainPage ? endIndex : rowsPerPage;
+      let rows: CSVRow[] = [];
+      let cursor: string | null = null;
+      let total = 0;
+      do {
+        const page: RowsPage = await fetchRowsPage(file, cursor, rows.length === 0);
+        if (page.total !== undefined) total = page.total;
+        rows = rows.concat(page.rows);
+        cursor = page.has_more && page.next_cursor ? page.next_cursor : null;
+      } while (cursor && rows.length < needed);
+
+      setAllCsvRows(rows);
+      setTotalRows(total);
+      setNextCursor(cursor);
+      setCurrentFile(file);
       
-      if (data.status) {
-        const sortedRows = (data.body || []).sort((a: CSVRow, b: CSVRow) => a.position - b.position);
-        setAllCsvRows(sortedRows);
-        setTotalRows(sortedRows.length);
-        setCurrentFile(file);
-        
-        // Only reset to first page if not maintaining current page
-        if (!maintainPage) {
-          setCurrentPage(1);
-        }
-      } else {
-        alert("Failed to load CSV data: " + data.message);
+      // Only reset to first page if not maintaining current page
+      if (!maintainPage) {
+        setCurrentPage(1);
       }
     } catch (err) {
       console.error("Error fetching CSV data:", err);
-      alert("Failed to load CSV data");
+      alert("Failed to load CSV data: " + (err instanceof Error ? err.message : err));
     } finally {
       setLoading(false);
     }
-  }, [token]);
+  }, [token, endIndex, rowsPerPage, fetchRowsPage]);
+
+  // Load further pages when the current page shows rows that are not
+  // loaded yet. Each run loads one page; it runs again until the page is full.
+  useEffect(() => {
+    if (!currentFile || !nextCursor || loading || loadingMore) return;
+    if (allCsvRows.length >= Math.min(endIndex, totalRows)) return;
+
+    setLoadingMore(true);
+    fetchRowsPage(currentFile, nextCursor, false)
+      .then(page => {
+        setAllCsvRows(prev => prev.concat(page.rows));
+        setNextCursor(page.has_more && page.next_cursor ? page.next_cursor : null);
+      })
+      .catch(err => {
+        console.error("Error fetching CSV data:", err);
+        alert("Failed to load CSV data: " + (err instanceof Error ? err.message : err));
+        setNextCursor(null);
+      })
+      .finally(() => setLoadingMore(false));
+  }, [currentFile, nextCursor, loading, loadingMore, allCsvRows.length, endIndex, totalRows, fetchRowsPage]);
 
   // Handle file click to display CSV data
   const handleFileClick = useCallback((file: FileItem) => {
@@ -308,6 +362,7 @@ export default function FilesPage() {
     setCurrentFile(null);
     setAllCsvRows([]);
     setTotalRows(0);
+    setNextCursor(null);
     setCurrentPage(1);
   }, []);
 
@@ -421,6 +476,7 @@ export default function FilesPage() {
         headers: {
           "Content-Type": "application/json",
           Authorization: "Bearer " + token,
+          "If-Match": `"${draggedRow.version}"`,
         },
         body: JSON.stringify({
           position: newPosition,
@@ -453,6 +509,7 @@ export default function FilesPage() {
         method: "DELETE",
         headers: {
           Authorization: "Bearer " + token,
+          "If-Match": `"${row.version}"`,
         },
       });
 
@@ -489,6 +546,7 @@ export default function FilesPage() {
         headers: {
           "Content-Type": "application/json",
           Authorization: "Bearer " + token,
+          "If-Match": `"${row.version}"`,
         },
         body: JSON.stringify({
           position: row.position,
@@ -496,16 +554,32 @@ export default function FilesPage() {
         }),
       });
 
-      const data = await res.json();
-      if (!data.status) {
+      const data = await res.json().catch(() => null);
+      if (res.ok && data?.status) {
+        // Keep the saved row, whose version the next edit has to send
+        setAllCsvRows(prev => prev.map(r =>
+          r.id === row.id ? { ...r, ...data.body } : r
+        ));
+      } else if (res.status === 409) {
+        // Someone else changed the row; show their version instead
+        const current: CSVRow | undefined = data?.body ?? data;
+        if (current?.id === row.id) {
+          setAllCsvRows(prev => prev.map(r =>
+            r.id === row.id ? { ...r, ...current } : r
+          ));
+        } else {
+          fetchCSVRows(currentFile, true); // Maintain current page
+        }
+        alert("This row was changed elsewhere and has been reloaded. Please make your edit again.");
+      } else {
         // Revert on failure
-        alert("Failed to update row: " + data.message);
+        alert("Failed to update row: " + (data?.message ?? res.statusText));
         fetchCSVRows(currentFile, true); // Maintain current page
       }
     } catch (err) {
       console.error("Error updating row:", err);
       alert("Failed to update row");
-      fetchCSVRows(currentFile);
+      fetchCSVRows(currentFile, true); // Maintain current page
     }
   }, [token, currentFile, fetchCSVRows]);
 